@@ -0,0 +1,54 @@
+const tokenStorageKey = "doorbell_admin_token";
+
+async function fetchStats(token, days, format) {
+    const from = new Date(Date.now() - days * 24 * 60 * 60 * 1000).toISOString();
+    const resp = await fetch(`/admin/stats?format=${format}&from=${encodeURIComponent(from)}`, {
+        headers: {
+            "Authorization": `Bearer ${token}`,
+        }
+    });
+
+    if (!resp.ok) {
+        const message = await resp.json()
+            .then(msg => msg.error)
+            .catch(() => resp.statusText);
+        throw new Error(message);
+    }
+
+    return resp;
+}
+
+window.addEventListener("load", () => {
+    const form = document.querySelector("form.token");
+    const status = document.querySelector("#status");
+    const table = document.querySelector("table.stats");
+    const heatmap = document.querySelector("#heatmap");
+
+    form.elements.token.value = sessionStorage.getItem(tokenStorageKey) || "";
+
+    form.addEventListener("submit", async (event) => {
+        event.preventDefault();
+        status.textContent = "";
+
+        const token = form.elements.token.value;
+        const days = Number(form.elements.days.value);
+        try {
+            const stats = await fetchStats(token, days, "json").then(resp => resp.json());
+            for (const key of ["rings", "closed", "rate_limited", "captcha_failed"]) {
+                document.getElementById(key).textContent = stats[key];
+            }
+            table.hidden = false;
+
+            const svg = await fetchStats(token, days, "svg").then(resp => resp.blob());
+            if (heatmap.src) {
+                URL.revokeObjectURL(heatmap.src);
+            }
+            heatmap.src = URL.createObjectURL(svg);
+            heatmap.hidden = false;
+
+            sessionStorage.setItem(tokenStorageKey, token);
+        } catch (err) {
+            status.textContent = err.message;
+        }
+    });
+});
@@ -1,2 +1,3 @@
-export const recaptchaSiteKey = "{{ .RecaptchaSiteKey }}";
+export const captchaProvider = "{{ .CaptchaProvider }}";
+export const captchaSiteKey = "{{ .CaptchaSiteKey }}";
 export const jwtStorageKey = "doorbell_jwt";
\ No newline at end of file
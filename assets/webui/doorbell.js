@@ -1,13 +1,13 @@
 import * as config from "./config.js";
 
-async function authVerifyRecaptcha(captchaResponse) {
-    const resp = await fetch("/auth/recaptcha", {
+async function postAuth(url, body) {
+    const resp = await fetch(url, {
         method: "POST",
         headers: {
             "Accept": "application/json",
             "Content-Type": "application/json",
         },
-        body: JSON.stringify({response: captchaResponse})
+        body: JSON.stringify(body)
     });
 
     if (!resp.ok) {
@@ -20,19 +20,63 @@ async function authVerifyRecaptcha(captchaResponse) {
     return await resp.json()
 }
 
-async function ringDoorbell(authToken, maxTries = 2) {
+function authVerifyCaptcha(captchaResponse) {
+    return postAuth("/auth/captcha", {response: captchaResponse});
+}
+
+function solveProofOfWork(challenge) {
+    return new Promise((resolve, reject) => {
+        const worker = new Worker("pow-worker.js");
+        worker.addEventListener("message", event => {
+            worker.terminate();
+            resolve({challenge: challenge.challenge, solution: event.data.solution});
+        });
+        worker.addEventListener("error", () => {
+            worker.terminate();
+            reject(new Error("Proof-of-work failed"));
+        });
+        worker.postMessage(challenge);
+    });
+}
+
+async function authProofOfWork() {
+    const resp = await fetch("/auth/pow", {
+        headers: {"Accept": "application/json"},
+    });
+
+    if (!resp.ok) {
+        throw new Error(resp.statusText);
+    }
+
+    return await postAuth("/auth/pow", await solveProofOfWork(await resp.json()));
+}
+
+// authStepUp solves the fallback challenge presented to visitors with a
+// mediocre captcha score
+async function authStepUp(stepUp) {
+    switch (stepUp.method) {
+        case "pow":
+            return await postAuth("/auth/stepup", {answer: await solveProofOfWork(stepUp.challenge)});
+        default:
+            throw new Error(`Unsupported verification method ${stepUp.method}`);
+    }
+}
+
+async function ringDoorbell(authToken, visitor, maxTries = 2) {
     const resp = await fetch("/ring", {
         method: "POST",
         headers: {
             "Accept": "application/json",
+            "Content-Type": "application/json",
             "Authorization": `Bearer ${await authToken.obtain()}`,
-        }
+        },
+        body: JSON.stringify(visitor)
     });
 
     if (!resp.ok) {
-        if (maxTries > 1) {
+        if (resp.status === 401 && maxTries > 1) {
             authToken.invalidate();
-            await ringDoorbell(authToken, maxTries - 1);
+            return await ringDoorbell(authToken, visitor, maxTries - 1);
         } else {
             const message = await resp.json()
                 .then(msg => msg.error)
@@ -40,25 +84,141 @@ async function ringDoorbell(authToken, maxTries = 2) {
             throw new Error(message)
         }
     }
+
+    return await resp.json();
+}
+
+// awaitStatus long polls the status of a ring and passes every change to
+// update, until the ring has expired, is forgotten or update returns false
+async function awaitStatus(authToken, ringId, update) {
+    let replies = 0;
+    for (;;) {
+        const resp = await fetch(`/ring/status?id=${encodeURIComponent(ringId)}&replies=${replies}`, {
+            headers: {
+                "Accept": "application/json",
+                "Authorization": `Bearer ${await authToken.obtain()}`,
+            }
+        });
+
+        if (!resp.ok) {
+            return;
+        }
+
+        const status = await resp.json();
+        if (status.status === "expired") {
+            update(status);
+            return;
+        }
+
+        if (status.status === "acknowledged" && status.replies.length > replies) {
+            replies = status.replies.length;
+            if (!update(status)) {
+                return;
+            }
+        }
+    }
+}
+
+function statusMessage(status) {
+    if (status.status === "expired") {
+        return "Nobody answered. Please try again later.";
+    }
+
+    let message;
+    switch (status.ack.reply) {
+        case "coming":
+            message = "Someone is on their way!";
+            break;
+        case "wait":
+            message = "Someone heard you, please wait a moment.";
+            break;
+        case "nobody":
+            message = "Sorry, nobody can open the door right now.";
+            break;
+        default:
+            message = "Someone heard the doorbell.";
+    }
+
+    for (const reply of status.replies) {
+        if (reply.message) {
+            message += ` ${reply.by}: “${reply.message}”`;
+        }
+    }
+    return message;
+}
+
+async function hcaptchaResponse(siteKey) {
+    const widget = hcaptcha.render("captcha", {sitekey: siteKey, size: "invisible"});
+    try {
+        const result = await hcaptcha.execute(widget, {async: true});
+        return result.response;
+    } finally {
+        hcaptcha.remove(widget);
+    }
+}
+
+function turnstileResponse(siteKey) {
+    return new Promise((resolve, reject) => {
+        const widget = turnstile.render("#captcha", {
+            sitekey: siteKey,
+            appearance: "interaction-only",
+            callback: token => {
+                turnstile.remove(widget);
+                resolve(token);
+            },
+            "error-callback": () => {
+                turnstile.remove(widget);
+                reject(new Error("Captcha verification failed"));
+            },
+        });
+    });
+}
+
+// must be one of the actions expected by the server (RECAPTCHA_ACTIONS)
+const recaptchaAction = "ring";
+
+function captchaResponse(provider, siteKey) {
+    switch (provider) {
+        case "hcaptcha":
+            return hcaptchaResponse(siteKey);
+        case "turnstile":
+            return turnstileResponse(siteKey);
+        default:
+            return grecaptcha.execute(siteKey, {action: recaptchaAction});
+    }
 }
 
 class AuthToken {
     constructor(conf) {
-        this.recaptchaSiteKey = conf.recaptchaSiteKey;
+        this.captchaProvider = conf.captchaProvider;
+        this.captchaSiteKey = conf.captchaSiteKey;
         this.jwtStoragekey = conf.jwtStorageKey;
     }
 
     async obtain() {
         let token = sessionStorage.getItem(this.jwtStoragekey);
         if (!token) {
-            token = await grecaptcha.execute(this.recaptchaSiteKey)
-                .then(authVerifyRecaptcha)
-                .then(r => r.token);
+            const auth = this.captchaProvider === "pow"
+                ? authProofOfWork()
+                : captchaResponse(this.captchaProvider, this.captchaSiteKey)
+                    .then(authVerifyCaptcha)
+                    .then(r => r.step_up ? authStepUp(r.step_up) : r);
+            token = await auth.then(r => r.token);
             sessionStorage.setItem(this.jwtStoragekey, token);
         }
         return token;
     }
 
+    async redeemCode(code) {
+        const r = await postAuth("/auth/code", {code: code});
+        sessionStorage.setItem(this.jwtStoragekey, r.token);
+    }
+
+    async login(username, password) {
+        const r = await postAuth("/auth/login", {username: username, password: password});
+        sessionStorage.setItem(this.jwtStoragekey, r.token);
+    }
+
     invalidate() {
         sessionStorage.removeItem(this.jwtStoragekey);
     }
@@ -71,19 +231,59 @@ function animateElement(elem, className) {
     elem.classList.add(className);
 }
 
+// takeLoginToken stores the jwt passed in the URL fragment after a single
+// sign-on login, removing it from the address bar
+function takeLoginToken(jwtStorageKey) {
+    const fragment = new URLSearchParams(window.location.hash.substring(1));
+    const token = fragment.get("token");
+    if (token) {
+        sessionStorage.setItem(jwtStorageKey, token);
+        history.replaceState(null, "", window.location.pathname + window.location.search);
+    }
+}
+
 window.addEventListener("load", () => {
+    takeLoginToken(config.jwtStorageKey);
     const userToken = new AuthToken(config);
 
     const button = document.querySelector("button.doorbell");
     const bell = document.querySelector(".bell-icon");
     const status = document.querySelector("#status");
+    const form = document.querySelector("form.visitor");
+
+    let currentRing = null;
 
     button.disabled = false;
     button.addEventListener("click", async () => {
         status.textContent = "";
         try {
-            await ringDoorbell(userToken);
+            const username = form.elements.username ? form.elements.username.value.trim() : "";
+            const password = form.elements.password ? form.elements.password.value : "";
+            const code = form.elements.code ? form.elements.code.value.trim() : "";
+            if (username && password) {
+                await userToken.login(username, password);
+                form.elements.password.value = "";
+            } else if (code) {
+                await userToken.redeemCode(code);
+                form.elements.code.value = "";
+            }
+
+            const ring = await ringDoorbell(userToken, {
+                name: form.elements.name.value,
+                message: form.elements.message.value,
+            });
             animateElement(bell, "animate");
+
+            currentRing = ring.id;
+            status.textContent = "Waiting for someone to answer…";
+            await awaitStatus(userToken, ring.id, ringStatus => {
+                if (currentRing !== ring.id) {
+                    return false;
+                }
+                status.textContent = statusMessage(ringStatus);
+                animateElement(status, "fadein");
+                return true;
+            });
         } catch (err) {
             if (err instanceof Error) {
                 status.textContent = err.message;
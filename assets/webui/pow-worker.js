@@ -0,0 +1,37 @@
+// Solves proof-of-work challenges issued by /auth/pow: finds a counter for
+// which SHA-256("<challenge>:<counter>") has enough leading zero bits.
+
+const batchSize = 256;
+const encoder = new TextEncoder();
+
+function leadingZeroBits(digest) {
+    let bits = 0;
+    for (const byte of digest) {
+        if (byte !== 0) {
+            return bits + Math.clz32(byte) - 24;
+        }
+        bits += 8;
+    }
+    return bits;
+}
+
+async function solve(challenge, difficulty) {
+    for (let counter = 0; ; counter += batchSize) {
+        const digests = [];
+        for (let i = counter; i < counter + batchSize; i++) {
+            digests.push(crypto.subtle.digest("SHA-256", encoder.encode(`${challenge}:${i}`)));
+        }
+
+        const results = await Promise.all(digests);
+        for (let i = 0; i < results.length; i++) {
+            if (leadingZeroBits(new Uint8Array(results[i])) >= difficulty) {
+                return String(counter + i);
+            }
+        }
+    }
+}
+
+self.addEventListener("message", async event => {
+    const {challenge, difficulty} = event.data;
+    self.postMessage({solution: await solve(challenge, difficulty)});
+});
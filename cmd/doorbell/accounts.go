@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+
+	"github.com/luxeria/doorbell/pkg/env"
+	"github.com/luxeria/doorbell/pkg/htpasswd"
+	"github.com/luxeria/doorbell/pkg/oidc"
+	"github.com/luxeria/doorbell/pkg/totp"
+)
+
+// newDoorCodeTotp returns the generator of rotating door codes, or nil if
+// no secret is configured
+func newDoorCodeTotp() *totp.Totp {
+	encoded := env.String("DOOR_CODE_SECRET", "")
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	secret, err := totp.DecodeSecret(encoded)
+	if err != nil {
+		log.Fatalf("failed to decode DOOR_CODE_SECRET as base32: %s", err)
+	}
+
+	return totp.New(totp.Config{
+		Secret: secret,
+		Period: env.Duration("DOOR_CODE_PERIOD", "168h"),
+		Digits: env.Int("DOOR_CODE_DIGITS", "6"),
+		Skew:   env.Int("DOOR_CODE_SKEW", "0"),
+	})
+}
+
+// newUsers opens the password file of members, or returns nil if login is
+// disabled
+func newUsers() *htpasswd.File {
+	path := env.String("USERS_FILE", "")
+	if len(path) == 0 {
+		return nil
+	}
+
+	users, err := htpasswd.Open(path)
+	if err != nil {
+		log.Fatalf("failed to open users file: %s", err)
+	}
+	return users
+}
+
+// newOIDC returns the OpenID Connect provider for single sign-on, or nil if
+// it is disabled
+func newOIDC() *oidc.Provider {
+	issuer := env.String("OIDC_ISSUER", "")
+	if len(issuer) == 0 {
+		return nil
+	}
+
+	return oidc.New(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     env.String("OIDC_CLIENT_ID"),
+		ClientSecret: env.String("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  env.String("OIDC_REDIRECT_URL"),
+		Scopes:       env.StringSlice("OIDC_SCOPES", `["profile"]`),
+	})
+}
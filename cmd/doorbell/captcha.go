@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+
+	"github.com/luxeria/doorbell/pkg/captcha"
+	"github.com/luxeria/doorbell/pkg/env"
+	"github.com/luxeria/doorbell/pkg/pow"
+	"github.com/luxeria/doorbell/pkg/recaptcha"
+	"github.com/luxeria/doorbell/pkg/rest/auth"
+)
+
+// newCaptcha returns the verifier and the site key of the captcha provider.
+// The pow provider uses proof-of-work only and has no captcha verifier.
+func newCaptcha(provider string) (captcha.Verifier, string) {
+	switch provider {
+	case "pow":
+		return nil, ""
+	case "recaptcha":
+		return recaptcha.New(recaptcha.Config{
+			Secret:       env.String("RECAPTCHA_SECRET_KEY"),
+			URL:          env.String("RECAPTCHA_VERIFY_URL", ""),
+			Timeout:      env.Duration("RECAPTCHA_TIMEOUT", "5s"),
+			Retries:      env.Int("RECAPTCHA_RETRIES", "2"),
+			RetryBackoff: env.Duration("RECAPTCHA_RETRY_BACKOFF", "250ms"),
+			Actions:      env.StringSlice("RECAPTCHA_ACTIONS", `["ring"]`),
+			Hostnames:    env.StringSlice("RECAPTCHA_HOSTNAMES", "[]"),
+			MaxAge:       env.Duration("RECAPTCHA_MAX_AGE", "2m"),
+		}), env.String("RECAPTCHA_SITE_KEY")
+	case "hcaptcha":
+		siteKey := env.String("HCAPTCHA_SITE_KEY")
+		return captcha.NewHCaptcha(siteKey, env.String("HCAPTCHA_SECRET_KEY")), siteKey
+	case "turnstile":
+		return captcha.NewTurnstile(env.String("TURNSTILE_SECRET_KEY")), env.String("TURNSTILE_SITE_KEY")
+	default:
+		log.Fatalf("unknown captcha provider %q, expected recaptcha, hcaptcha, turnstile or pow", provider)
+		return nil, ""
+	}
+}
+
+// newStandalonePow enables authentication by proof-of-work alone, which is
+// only done if it is the captcha provider, as it would bypass the captcha
+func newStandalonePow(provider string) *pow.Pow {
+	if provider != "pow" {
+		return nil
+	}
+	return newPow()
+}
+
+// newStepUp returns the fallback challenge for visitors with a mediocre
+// captcha score, or nil if they are rejected
+func newStepUp(method string) auth.StepUp {
+	switch method {
+	case "":
+		return nil
+	case "pow":
+		return auth.PowStepUp(newPow())
+	default:
+		log.Fatalf("unknown captcha step-up %q, expected pow", method)
+		return nil
+	}
+}
+
+func newPow() *pow.Pow {
+	return pow.New(pow.Config{
+		Secret:        env.Bytes("POW_SECRET", ""),
+		Difficulty:    env.Int("POW_DIFFICULTY", "16"),
+		MaxDifficulty: env.Int("POW_MAX_DIFFICULTY", "22"),
+		TTL:           env.Duration("POW_TTL", "2m"),
+		LoadStep:      env.Int("POW_LOAD_STEP", "30"),
+	})
+}
@@ -1,18 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
 	"github.com/luxeria/doorbell/pkg/env"
+	"github.com/luxeria/doorbell/pkg/health"
+	"github.com/luxeria/doorbell/pkg/history"
+	"github.com/luxeria/doorbell/pkg/metrics"
 	"github.com/luxeria/doorbell/pkg/rest/auth"
 	"github.com/luxeria/doorbell/pkg/rest/doorbell"
 	"github.com/luxeria/doorbell/pkg/webui"
 )
 
 func main() {
+	provider := env.String("CAPTCHA_PROVIDER", "recaptcha")
+	verifier, siteKey := newCaptcha(provider)
+
+	doorCodes := env.StringSlice("DOOR_CODES", "[]")
+	doorCodeTotp := newDoorCodeTotp()
+	users := newUsers()
+	sso := newOIDC()
+
 	values := webui.Values{
-		"RecaptchaSiteKey": env.String("RECAPTCHA_SITE_KEY"),
+		"CaptchaProvider": provider,
+		"CaptchaSiteKey":  siteKey,
+		"DoorCodes":       len(doorCodes) > 0 || doorCodeTotp != nil,
+		"PasswordLogin":   users != nil,
+		"OidcLogin":       sso != nil,
 	}
 	webUi, err := webui.New("assets/webui/", webui.Context{
 		"index.html": values,
@@ -22,25 +38,125 @@ func main() {
 		log.Fatalf("failed to load webui: %s", err)
 	}
 
+	ringHistory := newHistory()
+	bell := newRinger(ringHistory)
+
 	authApi := auth.New(auth.Config{
-		JwtSecret:         env.Bytes("JWT_SECRET"),
-		JwtExpiry:         env.Duration("JWT_EXPIRY", "15m"),
-		Recaptcha:         env.Recaptcha("RECAPTCHA_SECRET_KEY"),
-		RecaptchaMinScore: env.Float("RECAPTCHA_MIN_SCORE", "0.5"),
+		JwtSecret:           env.Bytes("JWT_SECRET"),
+		JwtExpiry:           env.Duration("JWT_EXPIRY", "15m"),
+		Captcha:             verifier,
+		CaptchaMinScore:     env.Float("CAPTCHA_MIN_SCORE", env.String("RECAPTCHA_MIN_SCORE", "0.5")),
+		AdminToken:          env.Bytes("ADMIN_TOKEN", ""),
+		MemberToken:         env.Bytes("MEMBER_TOKEN", ""),
+		StepUp:              newStepUp(env.String("CAPTCHA_STEP_UP", "")),
+		CaptchaStepUpScore:  env.Float("CAPTCHA_STEP_UP_SCORE", "0.1"),
+		Pow:                 newStandalonePow(provider),
+		DoorCodes:           doorCodes,
+		DoorCodeTotp:        doorCodeTotp,
+		DoorCodeJwtExpiry:   env.Duration("DOOR_CODE_JWT_EXPIRY", "12h"),
+		Users:               users,
+		AdminUsers:          env.StringSlice("ADMIN_USERS", "[]"),
+		LoginJwtExpiry:      env.Duration("LOGIN_JWT_EXPIRY", "12h"),
+		OIDC:                sso,
+		OIDCGroupsClaim:     env.String("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCMemberGroups:    env.StringSlice("OIDC_MEMBER_GROUPS", "[]"),
+		OIDCAdminGroups:     env.StringSlice("OIDC_ADMIN_GROUPS", "[]"),
+		MaxFailedAttempts:   env.Int("AUTH_MAX_FAILED_ATTEMPTS", "5"),
+		Lockout:             env.Duration("AUTH_LOCKOUT", "15m"),
+		History:             ringHistory,
 	})
 
 	bellApi := doorbell.New(doorbell.Config{
 		OpeningHours: env.OpeningHours("OPENING_HOURS", "Mo-Su 00:00-00:00"),
 		RateLimit:    env.RateLimit("RATELIMIT_BURST", "3/10s"),
-		DoorbellCmd:  env.StringSlice("DOORBELL_CMD", `["mpg123", "assets/dingdong.mp3"]`),
+		Ringer:       bell,
+		RingTimeout:  env.Duration("RING_TIMEOUT", "1m"),
+		AckTimeout:   env.Duration("RING_ACK_TIMEOUT", "5m"),
+		BlockedWords: env.StringSlice("RING_BLOCKED_WORDS", "[]"),
+		History:      ringHistory,
 	})
 
-	http.Handle("/webui/", http.StripPrefix("/webui/", webUi))
-	http.Handle("/auth/recaptcha", authApi.AuthRecaptcha())
-	http.Handle("/ring", authApi.CheckJwt(bellApi.Ring()))
-	http.Handle("/", http.RedirectHandler("/webui/", http.StatusFound))
+	checks := health.New()
+	checks.Liveness("webui", webUi.Check)
+	checks.Readiness("ringer", bell.Check)
+	if checker, ok := verifier.(health.Checker); ok {
+		checks.Readiness("captcha", checker.Check)
+	}
+	checks.Readiness("clock", health.ClockSynchronized)
+	if ringHistory != nil {
+		checks.Readiness("history", ringHistory.Check)
+	}
+	if users != nil {
+		checks.Readiness("users", users.Check)
+	}
+	if sso != nil {
+		checks.Readiness("oidc", sso.Check)
+	}
+
+	handle("/webui/", http.StripPrefix("/webui/", webUi))
+	handle("/auth/captcha", authApi.AuthCaptcha())
+	handle("/auth/recaptcha", authApi.AuthCaptcha())
+	handle("/auth/pow", authApi.AuthPow())
+	handle("/auth/stepup", authApi.AuthStepUp())
+	handle("/auth/code", authApi.AuthCode())
+	handle("/auth/login", authApi.AuthLogin())
+	handle("/auth/oidc/login", authApi.OIDCLogin())
+	handle("/auth/oidc/callback", authApi.OIDCCallback())
+	handle("/auth/member", authApi.AuthMember())
+	handle("/ring", authApi.CheckJwt(bellApi.Ring()))
+	handle("/ring/status", authApi.CheckJwt(bellApi.Status()))
+	handle("/ring/ack", authApi.CheckMember(bellApi.AcknowledgeRing()))
+	handle("/events", auth.QueryToken(authApi.CheckMember(bellApi.Events())))
+	handle("/ws", auth.QueryToken(authApi.RequireRole(auth.RoleMember, bellApi.WebSocket())))
+	handle("/admin/diagnostics", authApi.CheckAdmin(bellApi.Diagnostics()))
+	handle("/admin/history", authApi.CheckAdmin(bellApi.History()))
+	handle("/admin/stats", authApi.CheckAdmin(bellApi.Stats()))
+	handle("/admin/override", authApi.CheckAdmin(bellApi.Override()))
+	handle("/admin/code", authApi.CheckAdmin(authApi.DoorCode()))
+	handle("/admin/health", authApi.CheckAdmin(checks.Details()))
+	handle("/healthz", checks.Healthz())
+	handle("/readyz", checks.Readyz())
+	handle("/", http.RedirectHandler("/webui/", http.StatusFound))
+
+	// metrics are either served on a separate (internal) listener or to admins
+	if metricsAddr := env.Addr("METRICS_ADDR", ""); len(metricsAddr) > 0 {
+		go serveMetrics(metricsAddr)
+	} else {
+		handle("/metrics", authApi.CheckAdmin(metrics.Handler()))
+	}
 
 	addr := env.Addr("PORT", "8080")
 	log.Printf("doorbell api listening on %s", addr)
 	log.Fatalln(http.ListenAndServe(addr, nil))
-}
\ No newline at end of file
+}
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	log.Printf("metrics listening on %s", addr)
+	log.Fatalln(http.ListenAndServe(addr, mux))
+}
+
+// handle registers a handler, recording the latency of its requests
+func handle(route string, h http.Handler) {
+	http.Handle(route, metrics.InstrumentRoute(route, h))
+}
+
+func newHistory() *history.Log {
+	if len(env.String("HISTORY_PATH", "")) == 0 {
+		return nil
+	}
+
+	l, err := history.Open(history.Config{
+		Path:      env.String("HISTORY_PATH"),
+		Retention: env.Duration("HISTORY_RETENTION", "2160h"),
+		IPSalt:    env.Bytes("HISTORY_IP_SALT", ""),
+	})
+	if err != nil {
+		log.Fatalf("failed to open ring history: %s", err)
+	}
+
+	go l.RunPruning(context.Background())
+	return l
+}
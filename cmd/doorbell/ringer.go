@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/audio"
+	"github.com/luxeria/doorbell/pkg/env"
+	"github.com/luxeria/doorbell/pkg/history"
+	"github.com/luxeria/doorbell/pkg/mail"
+	"github.com/luxeria/doorbell/pkg/matrix"
+	"github.com/luxeria/doorbell/pkg/mqtt"
+	"github.com/luxeria/doorbell/pkg/ntfy"
+	"github.com/luxeria/doorbell/pkg/ringer"
+	"github.com/luxeria/doorbell/pkg/telegram"
+	"github.com/luxeria/doorbell/pkg/webhook"
+)
+
+func newChime() ringer.Ringer {
+	// play back the doorbell sound natively if configured, otherwise
+	// fall back to running an external command
+	if len(env.String("DOORBELL_AUDIO", "")) > 0 {
+		return ringer.NewAudio(
+			env.Audio("DOORBELL_AUDIO"),
+			audio.NewOutput(env.String("DOORBELL_AUDIO_OUTPUT", "/dev/snd/pcmC0D0p")),
+			env.Float("DOORBELL_AUDIO_VOLUME", "1.0"),
+		)
+	}
+
+	return ringer.NewCommand(
+		env.StringSlice("DOORBELL_CMD", `["mpg123", "assets/dingdong.mp3"]`),
+		env.Int("DOORBELL_CMD_HISTORY", "20"),
+	)
+}
+
+func newSpeech(chime ringer.Ringer) ringer.Ringer {
+	return ringer.NewSpeech(chime,
+		env.StringSlice("DOORBELL_TTS_CMD"),
+		audio.NewOutput(env.String("DOORBELL_TTS_OUTPUT", "/dev/snd/pcmC0D0p")),
+		env.Int("DOORBELL_TTS_CACHE", "32"),
+	)
+}
+
+func newMQTT() ringer.Ringer {
+	client, err := mqtt.New(mqtt.Config{
+		Broker:    env.String("MQTT_BROKER"),
+		ClientID:  env.String("MQTT_CLIENT_ID", "doorbell"),
+		KeepAlive: env.Duration("MQTT_KEEPALIVE", "60s"),
+	})
+	if err != nil {
+		log.Fatalf("failed to configure mqtt client: %s", err)
+	}
+
+	return ringer.NewMQTT(client,
+		env.String("MQTT_TOPIC", "doorbell/ring"),
+		env.Int("MQTT_QOS", "1"),
+		env.Bool("MQTT_RETAIN", "false"),
+	)
+}
+
+func newWebhook(targets []string) ringer.Ringer {
+	t, err := ringer.ParseWebhookTemplate(env.String("DOORBELL_WEBHOOK_TEMPLATE", ringer.DefaultWebhookTemplate))
+	if err != nil {
+		log.Fatalf("failed to parse webhook template: %s", err)
+	}
+
+	return ringer.NewWebhook(webhook.New(webhook.Config{
+		Targets:    targets,
+		Secret:     env.Bytes("DOORBELL_WEBHOOK_SECRET", ""),
+		Timeout:    env.Duration("DOORBELL_WEBHOOK_TIMEOUT", "5s"),
+		Retries:    env.Int("DOORBELL_WEBHOOK_RETRIES", "3"),
+		Backoff:    env.Duration("DOORBELL_WEBHOOK_BACKOFF", "1s"),
+		DeadLetter: env.String("DOORBELL_WEBHOOK_DEADLETTER", ""),
+	}), t)
+}
+
+func newMatrix() ringer.Ringer {
+	client := matrix.New(matrix.Config{
+		Homeserver:  env.String("MATRIX_HOMESERVER"),
+		AccessToken: env.String("MATRIX_ACCESS_TOKEN"),
+	})
+
+	return ringer.NewMatrix(client, env.StringSlice("MATRIX_ROOMS"))
+}
+
+func newTelegram() ringer.Ringer {
+	bot := telegram.New(telegram.Config{
+		Token: env.String("TELEGRAM_BOT_TOKEN"),
+	})
+
+	return ringer.NewTelegram(bot, env.StringSlice("TELEGRAM_CHAT_IDS"))
+}
+
+func newNtfy() ringer.Ringer {
+	client := ntfy.New(ntfy.Config{
+		TopicURL: env.String("NTFY_URL"),
+		Token:    env.String("NTFY_TOKEN", ""),
+		Username: env.String("NTFY_USERNAME", ""),
+		Password: env.String("NTFY_PASSWORD", ""),
+	})
+
+	return ringer.NewNtfy(client, ringer.NtfyConfig{
+		Title:    env.String("NTFY_TITLE", "Doorbell"),
+		Priority: env.String("NTFY_PRIORITY", "high"),
+		Tags:     env.StringSlice("NTFY_TAGS", `["bell"]`),
+		Click:    env.String("NTFY_CLICK", ""),
+		Dedup:    env.Duration("NTFY_DEDUP", "1m"),
+	})
+}
+
+// newMail computes the digest from the ring history, if it is enabled
+func newMail(h *history.Log) ringer.Ringer {
+	mailer, err := mail.New(mail.Config{
+		Addr:     env.String("SMTP_ADDR"),
+		Username: env.String("SMTP_USERNAME", ""),
+		Password: env.String("SMTP_PASSWORD", ""),
+		From:     env.String("MAIL_FROM"),
+		To:       env.StringSlice("MAIL_TO"),
+	})
+	if err != nil {
+		log.Fatalf("failed to configure mailer: %s", err)
+	}
+
+	templates, err := ringer.ParseMailTemplates(
+		env.String("MAIL_TEXT_TEMPLATE", ""),
+		env.String("MAIL_HTML_TEMPLATE", ""),
+	)
+	if err != nil {
+		log.Fatalf("failed to parse mail templates: %s", err)
+	}
+
+	var digest ringer.DigestFunc
+	if h != nil {
+		digest = h.Digest
+	}
+
+	m := ringer.NewMail(mailer, templates, digest)
+
+	if digestAt := env.String("MAIL_DIGEST_AT", "08:00"); len(digestAt) > 0 {
+		at, err := time.Parse("15:04", digestAt)
+		if err != nil {
+			log.Fatalf("failed to parse environment variable MAIL_DIGEST_AT as time of day: %s", err)
+		}
+		go m.RunDigest(context.Background(), at)
+	}
+
+	return m
+}
+
+// newRinger assembles all configured ringers
+func newRinger(h *history.Log) ringer.Multi {
+	chime := newChime()
+	if len(env.String("DOORBELL_TTS_CMD", "")) > 0 {
+		chime = newSpeech(chime)
+	}
+
+	ringers := ringer.Multi{chime}
+
+	if len(env.String("MQTT_BROKER", "")) > 0 {
+		ringers = append(ringers, newMQTT())
+	}
+
+	if targets := env.StringSlice("DOORBELL_WEBHOOKS", "[]"); len(targets) > 0 {
+		ringers = append(ringers, newWebhook(targets))
+	}
+
+	if len(env.String("MATRIX_HOMESERVER", "")) > 0 {
+		ringers = append(ringers, newMatrix())
+	}
+
+	if len(env.String("TELEGRAM_BOT_TOKEN", "")) > 0 {
+		ringers = append(ringers, newTelegram())
+	}
+
+	if len(env.String("NTFY_URL", "")) > 0 {
+		ringers = append(ringers, newNtfy())
+	}
+
+	if len(env.String("SMTP_ADDR", "")) > 0 {
+		ringers = append(ringers, newMail(h))
+	}
+
+	return ringers
+}
@@ -0,0 +1,198 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// constants and structures from <sound/asound.h>
+const (
+	sndrvPcmAccessRwInterleaved = 3
+	sndrvPcmFormatS16LE         = 2
+	sndrvPcmSubformatStd        = 0
+
+	sndrvPcmHwParamAccess    = 0
+	sndrvPcmHwParamFormat    = 1
+	sndrvPcmHwParamSubformat = 2
+
+	sndrvPcmHwParamFirstInterval = 8
+	sndrvPcmHwParamSampleBits    = 8
+	sndrvPcmHwParamFrameBits     = 9
+	sndrvPcmHwParamChannels      = 10
+	sndrvPcmHwParamRate          = 11
+	sndrvPcmHwParamPeriodSize    = 13
+	sndrvPcmHwParamPeriods       = 15
+
+	intervalInteger = 1 << 2
+
+	alsaPeriodSize  = 1024
+	alsaPeriodCount = 4
+)
+
+type sndMask struct {
+	bits [8]uint32
+}
+
+type sndInterval struct {
+	min, max uint32
+	flags    uint32
+}
+
+type sndPcmHwParams struct {
+	flags     uint32
+	masks     [3]sndMask
+	mres      [5]sndMask
+	intervals [12]sndInterval
+	ires      [9]sndInterval
+	rmask     uint32
+	cmask     uint32
+	info      uint32
+	msbits    uint32
+	rateNum   uint32
+	rateDen   uint32
+	fifoSize  uintptr
+	reserved  [64]byte
+}
+
+type sndXferi struct {
+	result uintptr
+	buf    uintptr
+	frames uintptr
+}
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'A'<<8 | nr
+}
+
+var (
+	sndrvPcmIoctlHwParams     = ioc(3, 0x11, unsafe.Sizeof(sndPcmHwParams{}))
+	sndrvPcmIoctlPrepare      = ioc(0, 0x40, 0)
+	sndrvPcmIoctlDrain        = ioc(0, 0x44, 0)
+	sndrvPcmIoctlWriteiFrames = ioc(1, 0x50, unsafe.Sizeof(sndXferi{}))
+)
+
+func ioctl(fd, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (p *sndPcmHwParams) init() {
+	for i := range p.masks {
+		p.masks[i].bits[0] = ^uint32(0)
+		p.masks[i].bits[1] = ^uint32(0)
+	}
+	for i := range p.intervals {
+		p.intervals[i].max = ^uint32(0)
+	}
+	p.rmask = ^uint32(0)
+	p.info = ^uint32(0)
+}
+
+func (p *sndPcmHwParams) setMask(param int, bit uint) {
+	m := &p.masks[param]
+	m.bits = [8]uint32{}
+	m.bits[bit/32] = 1 << (bit % 32)
+}
+
+func (p *sndPcmHwParams) setInt(param int, value uint32) {
+	i := &p.intervals[param-sndrvPcmHwParamFirstInterval]
+	i.min = value
+	i.max = value
+	i.flags = intervalInteger
+}
+
+func (p *sndPcmHwParams) setMin(param int, value uint32) {
+	p.intervals[param-sndrvPcmHwParamFirstInterval].min = value
+}
+
+type alsaOutput struct {
+	device string
+}
+
+// access(2) mode checking for write permission
+const accessWrite = 2
+
+// Check verifies that the playback device exists and is writable
+func (o *alsaOutput) Check() error {
+	err := syscall.Access(o.device, accessWrite)
+	if err != nil {
+		return fmt.Errorf("audio device %s is not writable: %s", o.device, err)
+	}
+	return nil
+}
+
+func (o *alsaOutput) Play(b *Buffer) error {
+	err := b.validate()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(o.device, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fd := f.Fd()
+
+	var params sndPcmHwParams
+	params.init()
+	params.setMask(sndrvPcmHwParamAccess, sndrvPcmAccessRwInterleaved)
+	params.setMask(sndrvPcmHwParamFormat, sndrvPcmFormatS16LE)
+	params.setMask(sndrvPcmHwParamSubformat, sndrvPcmSubformatStd)
+	params.setInt(sndrvPcmHwParamSampleBits, 16)
+	params.setInt(sndrvPcmHwParamFrameBits, uint32(16*b.Channels))
+	params.setInt(sndrvPcmHwParamChannels, uint32(b.Channels))
+	params.setInt(sndrvPcmHwParamRate, uint32(b.SampleRate))
+	params.setMin(sndrvPcmHwParamPeriodSize, alsaPeriodSize)
+	params.setInt(sndrvPcmHwParamPeriods, alsaPeriodCount)
+
+	err = ioctl(fd, sndrvPcmIoctlHwParams, uintptr(unsafe.Pointer(&params)))
+	if err != nil {
+		return fmt.Errorf("failed to set hardware parameters on %s: %s", o.device, err)
+	}
+
+	err = ioctl(fd, sndrvPcmIoctlPrepare, 0)
+	if err != nil {
+		return fmt.Errorf("failed to prepare %s: %s", o.device, err)
+	}
+
+	frames := b.Frames()
+	for written := 0; written < frames; {
+		offset := written * b.Channels
+		xfer := sndXferi{
+			buf:    uintptr(unsafe.Pointer(&b.Samples[offset])),
+			frames: uintptr(frames - written),
+		}
+
+		err = ioctl(fd, sndrvPcmIoctlWriteiFrames, uintptr(unsafe.Pointer(&xfer)))
+		runtime.KeepAlive(b.Samples)
+		if err == syscall.EPIPE {
+			// buffer underrun, recover and retry
+			err = ioctl(fd, sndrvPcmIoctlPrepare, 0)
+			if err != nil {
+				return fmt.Errorf("failed to recover from underrun on %s: %s", o.device, err)
+			}
+			continue
+		} else if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to write to %s: %s", o.device, err)
+		}
+
+		written += int(xfer.result)
+	}
+
+	err = ioctl(fd, sndrvPcmIoctlDrain, 0)
+	if err != nil {
+		return fmt.Errorf("failed to drain %s: %s", o.device, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package audio
+
+import (
+	"errors"
+)
+
+type alsaOutput struct {
+	device string
+}
+
+func (o *alsaOutput) Play(b *Buffer) error {
+	return errors.New("alsa playback is only supported on linux")
+}
+
+func (o *alsaOutput) Check() error {
+	return errors.New("alsa playback is only supported on linux")
+}
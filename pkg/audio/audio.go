@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"os"
+	"time"
+)
+
+// Buffer holds signed 16-bit PCM samples, interleaved by channel
+type Buffer struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+func (b *Buffer) Frames() int {
+	if b.Channels == 0 {
+		return 0
+	}
+	return len(b.Samples) / b.Channels
+}
+
+func (b *Buffer) Duration() time.Duration {
+	if b.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(b.Frames()) * time.Second / time.Duration(b.SampleRate)
+}
+
+// Scale returns a copy of the buffer with all samples multiplied by volume,
+// clipping samples which would overflow
+func (b *Buffer) Scale(volume float64) *Buffer {
+	scaled := &Buffer{
+		SampleRate: b.SampleRate,
+		Channels:   b.Channels,
+		Samples:    make([]int16, len(b.Samples)),
+	}
+
+	for i, s := range b.Samples {
+		v := math.Round(float64(s) * volume)
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		} else if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		scaled.Samples[i] = int16(v)
+	}
+
+	return scaled
+}
+
+func (b *Buffer) validate() error {
+	if b.SampleRate <= 0 {
+		return errors.New("invalid sample rate")
+	}
+
+	if b.Channels <= 0 {
+		return errors.New("invalid number of channels")
+	}
+
+	if len(b.Samples)%b.Channels != 0 {
+		return errors.New("number of samples is not a multiple of the channel count")
+	}
+
+	return nil
+}
+
+func LoadWAV(path string) (*Buffer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeWAV(f)
+}
@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Output plays back a buffer, blocking until playback has completed
+type Output interface {
+	Play(b *Buffer) error
+}
+
+// Checker is implemented by outputs which can check whether they are
+// writable without playing back anything
+type Checker interface {
+	Check() error
+}
+
+const alsaDevicePrefix = "/dev/snd/pcm"
+
+// NewOutput returns the output for the given path. Paths to ALSA playback
+// devices (e.g. /dev/snd/pcmC0D0p) are written to using the kernel PCM
+// interface, paths ending in .wav are rendered as wave files, and any other
+// path (e.g. a named pipe) receives raw signed 16-bit little endian samples.
+// The path is opened anew for every playback.
+func NewOutput(path string) Output {
+	switch {
+	case strings.HasPrefix(path, alsaDevicePrefix):
+		return &alsaOutput{device: path}
+	case strings.EqualFold(filepath.Ext(path), ".wav"):
+		return &fileOutput{path: path, wav: true}
+	default:
+		return &fileOutput{path: path}
+	}
+}
+
+type fileOutput struct {
+	path string
+	wav  bool
+}
+
+func (o *fileOutput) Play(b *Buffer) error {
+	err := b.validate()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if o.wav {
+		err = EncodeWAV(f, b)
+	} else {
+		err = binary.Write(f, binary.LittleEndian, b.Samples)
+	}
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Check verifies that the directory of the output file exists
+func (o *fileOutput) Check() error {
+	dir, err := os.Stat(filepath.Dir(o.path))
+	if err != nil {
+		return err
+	}
+
+	if !dir.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(o.path))
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+func readChunkHeader(r io.Reader) (id string, size uint32, err error) {
+	var header [8]byte
+	_, err = io.ReadFull(r, header[:])
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(header[0:4]), binary.LittleEndian.Uint32(header[4:8]), nil
+}
+
+func parseFormat(chunk []byte) (f wavFormat, err error) {
+	if len(chunk) < 16 {
+		return f, errors.New("wav format chunk too short")
+	}
+
+	err = binary.Read(bytes.NewReader(chunk), binary.LittleEndian, &f)
+	if err != nil {
+		return f, err
+	}
+
+	// WAVE_FORMAT_EXTENSIBLE stores the actual format in the sub format guid
+	if f.AudioFormat == wavFormatExtensible {
+		if len(chunk) < 26 {
+			return f, errors.New("wav extensible format chunk too short")
+		}
+		f.AudioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+
+	switch {
+	case f.AudioFormat == wavFormatPCM && f.BitsPerSample == 8:
+	case f.AudioFormat == wavFormatPCM && f.BitsPerSample == 16:
+	case f.AudioFormat == wavFormatPCM && f.BitsPerSample == 24:
+	case f.AudioFormat == wavFormatPCM && f.BitsPerSample == 32:
+	case f.AudioFormat == wavFormatFloat && f.BitsPerSample == 32:
+	default:
+		return f, fmt.Errorf("unsupported wav format %#04x with %d bits per sample", f.AudioFormat, f.BitsPerSample)
+	}
+
+	if f.Channels == 0 || f.SampleRate == 0 {
+		return f, errors.New("wav format has no channels or sample rate")
+	}
+
+	return f, nil
+}
+
+func convertSamples(f wavFormat, data []byte) []int16 {
+	width := int(f.BitsPerSample / 8)
+	samples := make([]int16, len(data)/width)
+	for i := range samples {
+		s := data[i*width : (i+1)*width]
+		switch {
+		case width == 1:
+			// 8-bit wav samples are unsigned
+			samples[i] = int16(int(s[0])-128) << 8
+		case width == 2:
+			samples[i] = int16(binary.LittleEndian.Uint16(s))
+		case width == 3:
+			samples[i] = int16(uint16(s[1]) | uint16(s[2])<<8)
+		case f.AudioFormat == wavFormatFloat:
+			v := float64(math.Float32frombits(binary.LittleEndian.Uint32(s)))
+			samples[i] = int16(math.Max(-1, math.Min(1, v)) * math.MaxInt16)
+		default:
+			samples[i] = int16(binary.LittleEndian.Uint32(s) >> 16)
+		}
+	}
+	return samples
+}
+
+// DecodeWAV reads a RIFF WAVE file containing integer or floating point PCM
+// samples and converts them to 16-bit samples
+func DecodeWAV(r io.Reader) (*Buffer, error) {
+	id, _, err := readChunkHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var wave [4]byte
+	_, err = io.ReadFull(r, wave[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if id != "RIFF" || string(wave[:]) != "WAVE" {
+		return nil, errors.New("not a riff wave file")
+	}
+
+	var format *wavFormat
+	for {
+		id, size, err := readChunkHeader(r)
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("wav file has no data chunk")
+			}
+			return nil, err
+		}
+
+		// chunks are padded to an even size
+		padded := int64(size) + int64(size%2)
+
+		switch id {
+		case "fmt ":
+			chunk := make([]byte, padded)
+			_, err = io.ReadFull(r, chunk)
+			if err != nil {
+				return nil, err
+			}
+
+			f, err := parseFormat(chunk[:size])
+			if err != nil {
+				return nil, err
+			}
+			format = &f
+		case "data":
+			if format == nil {
+				return nil, errors.New("wav data chunk precedes format chunk")
+			}
+
+			data := make([]byte, size)
+			_, err = io.ReadFull(r, data)
+			if err != nil {
+				return nil, err
+			}
+
+			b := &Buffer{
+				SampleRate: int(format.SampleRate),
+				Channels:   int(format.Channels),
+				Samples:    convertSamples(*format, data),
+			}
+			// drop trailing incomplete frame, if any
+			b.Samples = b.Samples[:b.Frames()*b.Channels]
+			return b, nil
+		default:
+			_, err = io.CopyN(ioutil.Discard, r, padded)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// EncodeWAV writes the buffer as a 16-bit PCM RIFF WAVE file
+func EncodeWAV(w io.Writer, b *Buffer) error {
+	err := b.validate()
+	if err != nil {
+		return err
+	}
+
+	dataSize := uint32(len(b.Samples) * 2)
+	header := struct {
+		RiffID   [4]byte
+		RiffSize uint32
+		WaveID   [4]byte
+		FmtID    [4]byte
+		FmtSize  uint32
+		Format   wavFormat
+		DataID   [4]byte
+		DataSize uint32
+	}{
+		RiffSize: 36 + dataSize,
+		FmtSize:  16,
+		Format: wavFormat{
+			AudioFormat:   wavFormatPCM,
+			Channels:      uint16(b.Channels),
+			SampleRate:    uint32(b.SampleRate),
+			ByteRate:      uint32(b.SampleRate * b.Channels * 2),
+			BlockAlign:    uint16(b.Channels * 2),
+			BitsPerSample: 16,
+		},
+		DataSize: dataSize,
+	}
+	copy(header.RiffID[:], "RIFF")
+	copy(header.WaveID[:], "WAVE")
+	copy(header.FmtID[:], "fmt ")
+	copy(header.DataID[:], "data")
+
+	err = binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, b.Samples)
+}
@@ -0,0 +1,155 @@
+package audio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeWAV(t *testing.T) {
+	b := &Buffer{
+		SampleRate: 8000,
+		Channels:   2,
+		Samples:    []int16{0, 1, -1, 32767, -32768, 1234},
+	}
+
+	var buf bytes.Buffer
+	err := EncodeWAV(&buf, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 44+len(b.Samples)*2 {
+		t.Errorf("unexpected wav file size %d", buf.Len())
+	}
+
+	decoded, err := DecodeWAV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.SampleRate != b.SampleRate || decoded.Channels != b.Channels {
+		t.Errorf("format mismatch: got %d Hz/%d channels", decoded.SampleRate, decoded.Channels)
+	}
+
+	if len(decoded.Samples) != len(b.Samples) {
+		t.Fatalf("expected %d samples, got %d", len(b.Samples), len(decoded.Samples))
+	}
+
+	for i := range b.Samples {
+		if decoded.Samples[i] != b.Samples[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, b.Samples[i], decoded.Samples[i])
+		}
+	}
+}
+
+func TestDecodeWAV8Bit(t *testing.T) {
+	wav := []byte("RIFF\x28\x00\x00\x00WAVE" +
+		"fmt \x10\x00\x00\x00\x01\x00\x01\x00\x40\x1f\x00\x00\x40\x1f\x00\x00\x01\x00\x08\x00" +
+		"LIST\x01\x00\x00\x00x\x00" +
+		"data\x03\x00\x00\x00\x00\x80\xff")
+
+	b, err := DecodeWAV(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int16{-32768, 0, 32512}
+	if len(b.Samples) != len(expected) {
+		t.Fatalf("expected %d samples, got %d", len(expected), len(b.Samples))
+	}
+
+	for i := range expected {
+		if b.Samples[i] != expected[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, expected[i], b.Samples[i])
+		}
+	}
+}
+
+func TestDecodeInvalidWAV(t *testing.T) {
+	_, err := DecodeWAV(bytes.NewReader([]byte("ID3\x03\x00\x00\x00\x00\x00\x00\x00\x00")))
+	if err == nil {
+		t.Error("decoder did not reject non-wav file")
+	}
+
+	_, err = DecodeWAV(bytes.NewReader([]byte("RIFF\x04\x00\x00\x00WAVE")))
+	if err == nil {
+		t.Error("decoder did not reject wav file without data")
+	}
+}
+
+func TestScale(t *testing.T) {
+	b := &Buffer{SampleRate: 8000, Channels: 1, Samples: []int16{100, -100, 30000, -30000}}
+
+	half := b.Scale(0.5)
+	if half.Samples[0] != 50 || half.Samples[1] != -50 {
+		t.Errorf("unexpected scaled samples: %v", half.Samples)
+	}
+
+	double := b.Scale(2)
+	if double.Samples[2] != 32767 || double.Samples[3] != -32768 {
+		t.Errorf("scaled samples were not clipped: %v", double.Samples)
+	}
+
+	if b.Samples[0] != 100 {
+		t.Error("scaling modified original buffer")
+	}
+
+	if b.Duration() != 500*time.Microsecond {
+		t.Errorf("unexpected duration %s", b.Duration())
+	}
+}
+
+func TestRenderToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Buffer{SampleRate: 44100, Channels: 1, Samples: []int16{1, 2, 3}}
+
+	path := filepath.Join(dir, "out.wav")
+	err = NewOutput(path).Play(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := LoadWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.SampleRate != 44100 || len(rendered.Samples) != 3 || rendered.Samples[2] != 3 {
+		t.Errorf("unexpected rendered file: %+v", rendered)
+	}
+
+	raw := filepath.Join(dir, "out.raw")
+	err = NewOutput(raw).Play(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte{1, 0, 2, 0, 3, 0}) {
+		t.Errorf("unexpected raw output: %v", data)
+	}
+}
+
+func TestLoadAsset(t *testing.T) {
+	b, err := LoadWAV("../../assets/dingdong.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Duration() < time.Second {
+		t.Errorf("doorbell sound is suspiciously short (%s)", b.Duration())
+	}
+}
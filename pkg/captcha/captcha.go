@@ -0,0 +1,187 @@
+// Package captcha defines a common interface for captcha providers and
+// implements the siteverify protocol shared by most of them.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Verification is the normalized result of verifying a captcha response
+type Verification struct {
+	Success bool `json:"success"`
+	// Score ranges from 0.0 (likely a bot) to 1.0 (likely a human).
+	// Providers without risk assessment report 1.0 for solved captchas.
+	Score       float64   `json:"score"`
+	Hostname    string    `json:"hostname"`
+	Action      string    `json:"action"`
+	ChallengeTS time.Time `json:"challenge_ts"`
+	ErrorCodes  []string  `json:"error_codes,omitempty"`
+}
+
+// Verifier verifies captcha responses submitted by the web UI
+type Verifier interface {
+	// Name is the human readable name of the provider
+	Name() string
+	Verify(ctx context.Context, response, remoteIP string) (Verification, error)
+}
+
+// SiteVerify is a client of the siteverify API, which is implemented by
+// reCAPTCHA, hCaptcha and Turnstile alike
+type SiteVerify struct {
+	URL    string
+	Secret string
+	// Client defaults to a client with a timeout of 10 seconds
+	Client *http.Client
+	// Timeout limits each attempt, in addition to the deadline of the context
+	Timeout time.Duration
+	// Retries is the number of additional attempts after server errors, or
+	// network errors which occurred before the response was sent. Responses
+	// can only be verified once, so a request which may have reached the
+	// provider (e.g. one which timed out) is never repeated.
+	Retries int
+	// Backoff is the delay before the first retry, doubling with each retry
+	Backoff time.Duration
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s *SiteVerify) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+// Post submits a response for verification and decodes the reply into v
+func (s *SiteVerify) Post(ctx context.Context, response, remoteIP string, extra url.Values, v interface{}) error {
+	form := url.Values{
+		"secret":   {s.Secret},
+		"response": {response},
+	}
+	if len(remoteIP) > 0 {
+		form.Set("remoteip", remoteIP)
+	}
+	for key, values := range extra {
+		form[key] = values
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, form, v)
+		if err == nil || !retry || attempt >= s.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single attempt, reporting whether a failure can be retried
+func (s *SiteVerify) post(ctx context.Context, form url.Values, v interface{}) (bool, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var sent int32
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			atomic.StoreInt32(&sent, 1)
+		},
+	})
+
+	resp, err := s.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return atomic.LoadInt32(&sent) == 0 && !isTimeout(err), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("siteverify returned %s", resp.Status)
+	}
+
+	return false, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func isTimeout(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// Check reports whether the siteverify API is reachable
+func (s *SiteVerify) Check(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodPost, s.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("siteverify returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Result is the reply of the siteverify API, with the fields of all
+// providers
+type Result struct {
+	Success     bool      `json:"success"`
+	Score       *float64  `json:"score"`
+	Action      string    `json:"action"`
+	ChallengeTS time.Time `json:"challenge_ts"`
+	Hostname    string    `json:"hostname"`
+	ErrorCodes  []string  `json:"error-codes"`
+}
+
+// Verification normalizes the reply, returning an error if the response
+// was not successfully verified
+func (r Result) Verification() (Verification, error) {
+	v := Verification{
+		Success:     r.Success,
+		Score:       1.0,
+		Hostname:    r.Hostname,
+		Action:      r.Action,
+		ChallengeTS: r.ChallengeTS,
+		ErrorCodes:  r.ErrorCodes,
+	}
+
+	if !r.Success {
+		v.Score = 0
+		if len(r.ErrorCodes) > 0 {
+			return v, fmt.Errorf("siteverify returned: %s", strings.Join(r.ErrorCodes, ", "))
+		}
+		return v, fmt.Errorf("captcha response token was invalid")
+	}
+
+	return v, nil
+}
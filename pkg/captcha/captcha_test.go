@@ -0,0 +1,88 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func siteverifyServer(t *testing.T, reply string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "secret" || r.PostFormValue("remoteip") != "192.0.2.1" {
+			t.Errorf("unexpected form: %v", r.PostForm)
+		}
+		fmt.Fprint(w, reply)
+	}))
+}
+
+func TestHCaptchaScore(t *testing.T) {
+	s := siteverifyServer(t, `{"success": true, "hostname": "doorbell.example", "score": 0.25}`)
+	defer s.Close()
+
+	h := NewHCaptcha("site", "secret")
+	h.URL = s.URL
+
+	v, err := h.Verify(context.Background(), "token", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Success || v.Score != 0.75 || v.Hostname != "doorbell.example" {
+		t.Errorf("unexpected verification: %+v", v)
+	}
+}
+
+func TestTurnstileFailure(t *testing.T) {
+	s := siteverifyServer(t, `{"success": false, "error-codes": ["timeout-or-duplicate"]}`)
+	defer s.Close()
+
+	ts := NewTurnstile("secret")
+	ts.URL = s.URL
+
+	v, err := ts.Verify(context.Background(), "token", "192.0.2.1")
+	if err == nil || err.Error() != "siteverify returned: timeout-or-duplicate" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if v.Success || v.Score != 0 {
+		t.Errorf("failed verification has success or score: %+v", v)
+	}
+}
+
+func TestSiteVerifyRetries(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		// the response may have been used up, but the reply is lost
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer s.Close()
+
+	sv := &SiteVerify{
+		URL:     s.URL,
+		Secret:  "secret",
+		Retries: 3,
+		Backoff: time.Millisecond,
+	}
+
+	var result Result
+	err := sv.Post(context.Background(), "token", "", nil, &result)
+	if err == nil {
+		t.Fatal("expected lost reply to fail")
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected a retry after the server error only, got %d requests", n)
+	}
+}
@@ -0,0 +1,126 @@
+// Package captchatest provides a fake siteverify server, so captcha
+// verification can be tested without access to the captcha providers.
+package captchatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/captcha"
+)
+
+// Server is a fake siteverify API. Response tokens have to be registered
+// with Solve and can be verified only once, like real ones.
+type Server struct {
+	*httptest.Server
+	secret   string
+	results  map[string]captcha.Result
+	used     map[string]bool
+	failures int
+	delay    time.Duration
+	requests int
+	mutex    sync.Mutex
+}
+
+// NewServer starts a siteverify server accepting the given secret
+func NewServer(secret string) *Server {
+	s := &Server{
+		secret:  secret,
+		results: make(map[string]captcha.Result),
+		used:    make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Solve registers the result to be returned for a response token
+func (s *Server) Solve(response string, result captcha.Result) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.results[response] = result
+}
+
+// FailNext lets the next n requests fail with 503 Service Unavailable
+func (s *Server) FailNext(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures = n
+}
+
+// SetDelay delays all replies, to simulate a slow provider
+func (s *Server) SetDelay(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.delay = d
+}
+
+// Requests returns the number of requests received so far
+func (s *Server) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests
+}
+
+// Score returns a pointer to a score, as used by captcha.Result
+func Score(score float64) *float64 {
+	return &score
+}
+
+func failure(codes ...string) captcha.Result {
+	return captcha.Result{Success: false, ErrorCodes: codes}
+}
+
+func (s *Server) reply(r *http.Request) (int, captcha.Result) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		return http.StatusServiceUnavailable, captcha.Result{}
+	}
+
+	if r.PostFormValue("secret") != s.secret {
+		return http.StatusOK, failure("invalid-input-secret")
+	}
+
+	response := r.PostFormValue("response")
+	if s.used[response] {
+		return http.StatusOK, failure("timeout-or-duplicate")
+	}
+
+	result, ok := s.results[response]
+	if !ok {
+		return http.StatusOK, failure("invalid-input-response")
+	}
+
+	s.used[response] = true
+	return http.StatusOK, result
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	delay := s.delay
+	s.mutex.Unlock()
+
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(delay):
+	}
+
+	code, result := s.reply(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if code == http.StatusOK {
+		json.NewEncoder(w).Encode(result)
+	}
+}
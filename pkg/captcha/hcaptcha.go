@@ -0,0 +1,50 @@
+package captcha
+
+import (
+	"context"
+	"net/url"
+)
+
+const hCaptchaVerifyURL = "https://api.hcaptcha.com/siteverify"
+
+// HCaptcha verifies hCaptcha responses
+type HCaptcha struct {
+	SiteVerify
+	siteKey string
+}
+
+func NewHCaptcha(siteKey, secret string) *HCaptcha {
+	return &HCaptcha{
+		SiteVerify: SiteVerify{URL: hCaptchaVerifyURL, Secret: secret},
+		siteKey:    siteKey,
+	}
+}
+
+func (h *HCaptcha) Name() string {
+	return "hCaptcha"
+}
+
+func (h *HCaptcha) Verify(ctx context.Context, response, remoteIP string) (Verification, error) {
+	var extra url.Values
+	if len(h.siteKey) > 0 {
+		extra = url.Values{"sitekey": {h.siteKey}}
+	}
+
+	var r Result
+	err := h.Post(ctx, response, remoteIP, extra, &r)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	v, err := r.Verification()
+	if err != nil {
+		return v, err
+	}
+
+	// the score of hCaptcha Enterprise is a risk score, 1.0 being a bot
+	if r.Score != nil {
+		v.Score = 1.0 - *r.Score
+	}
+
+	return v, nil
+}
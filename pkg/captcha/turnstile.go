@@ -0,0 +1,32 @@
+package captcha
+
+import (
+	"context"
+)
+
+const turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+
+// Turnstile verifies Cloudflare Turnstile responses
+type Turnstile struct {
+	SiteVerify
+}
+
+func NewTurnstile(secret string) *Turnstile {
+	return &Turnstile{
+		SiteVerify: SiteVerify{URL: turnstileVerifyURL, Secret: secret},
+	}
+}
+
+func (t *Turnstile) Name() string {
+	return "Turnstile"
+}
+
+func (t *Turnstile) Verify(ctx context.Context, response, remoteIP string) (Verification, error) {
+	var r Result
+	err := t.Post(ctx, response, remoteIP, nil, &r)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	return r.Verification()
+}
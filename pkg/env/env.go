@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/luxeria/doorbell/pkg/audio"
 	"github.com/luxeria/doorbell/pkg/recaptcha"
 	"github.com/luxeria/doorbell/pkg/openinghours"
 	"github.com/luxeria/doorbell/pkg/ratelimit"
@@ -28,6 +29,22 @@ func Bytes(key string, fallback ...string) []byte {
 	return []byte(String(key, fallback...))
 }
 
+func Bool(key string, fallback ...string) bool {
+	value, err := strconv.ParseBool(String(key, fallback...))
+	if err != nil {
+		log.Fatalf("failed to parse environment variable %s as boolean: %s", key, err)
+	}
+	return value
+}
+
+func Int(key string, fallback ...string) int {
+	value, err := strconv.Atoi(String(key, fallback...))
+	if err != nil {
+		log.Fatalf("failed to parse environment variable %s as integer: %s", key, err)
+	}
+	return value
+}
+
 func Float(key string, fallback ...string) float64 {
 	value, err := strconv.ParseFloat(String(key, fallback...), 64)
 	if err != nil {
@@ -61,7 +78,15 @@ func RateLimit(key string, fallback ...string) *ratelimit.Bucket {
 }
 
 func Recaptcha(key string, fallback ...string) *recaptcha.Recaptcha {
-	return recaptcha.New(String(key, fallback...))
+	return recaptcha.New(recaptcha.Config{Secret: String(key, fallback...)})
+}
+
+func Audio(key string, fallback ...string) *audio.Buffer {
+	value, err := audio.LoadWAV(String(key, fallback...))
+	if err != nil {
+		log.Fatalf("failed to load audio file from environment variable %s: %s", key, err)
+	}
+	return value
 }
 
 func StringSlice(key string, fallback ...string) []string {
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"syscall"
+)
+
+// return value of adjtimex(2) if the clock is not synchronized
+const timeError = 5
+
+// ClockSynchronized checks whether the kernel considers the system clock to
+// be synchronized, e.g. by an NTP daemon. This matters on devices without a
+// real-time clock, where the opening hours would be off otherwise.
+func ClockSynchronized(ctx context.Context) error {
+	var timex syscall.Timex
+	state, err := syscall.Adjtimex(&timex)
+	if err != nil {
+		return err
+	}
+
+	if state == timeError {
+		return errors.New("system clock is not synchronized")
+	}
+
+	return nil
+}
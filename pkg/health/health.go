@@ -0,0 +1,209 @@
+// Package health runs self-checks registered by the subsystems of the
+// doorbell and reports them for liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Func checks the health of a subsystem, returning an error if unhealthy
+type Func func(ctx context.Context) error
+
+// Checker is implemented by subsystems which can check their health
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const (
+	// how long all checks may take together
+	checkTimeout = 5 * time.Second
+	// how long reports are reused, so that frequent or malicious probes do
+	// not cause requests to remote services each time
+	reportTTL = 10 * time.Second
+)
+
+type check struct {
+	name     string
+	check    Func
+	liveness bool
+}
+
+// Checks is a set of named health checks. Liveness checks verify that the
+// process itself is working, readiness checks additionally cover everything
+// it depends on to ring the doorbell.
+type Checks struct {
+	checks []check
+	mutex  sync.Mutex
+	// latest liveness and readiness reports, guarded by running
+	cached  [2]cachedReport
+	running sync.Mutex
+}
+
+type cachedReport struct {
+	report Report
+	time   time.Time
+}
+
+func New() *Checks {
+	return &Checks{}
+}
+
+func (c *Checks) add(name string, f Func, liveness bool) {
+	if f == nil {
+		panic("health check is nil")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checks = append(c.checks, check{name: name, check: f, liveness: liveness})
+}
+
+// Liveness registers a check which is part of both /healthz and /readyz
+func (c *Checks) Liveness(name string, f Func) {
+	c.add(name, f, true)
+}
+
+// Readiness registers a check which is only part of /readyz
+func (c *Checks) Readiness(name string, f Func) {
+	c.add(name, f, false)
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Run runs the liveness checks, or all checks if readiness is set,
+// concurrently
+func (c *Checks) Run(ctx context.Context, readiness bool) Report {
+	c.mutex.Lock()
+	var checks []check
+	for _, chk := range c.checks {
+		if chk.liveness || readiness {
+			checks = append(checks, chk)
+		}
+	}
+	c.mutex.Unlock()
+
+	sort.SliceStable(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+
+			started := time.Now()
+			err := chk.check(ctx)
+			results[i] = Result{
+				Status:     StatusOK,
+				DurationMs: time.Since(started).Nanoseconds() / int64(time.Millisecond),
+			}
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}(i, chk)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(checks)),
+	}
+	for i, chk := range checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+// cachedRun returns the latest report if it is recent enough, and runs the
+// checks otherwise. Concurrent callers wait for a single run.
+func (c *Checks) cachedRun(readiness bool) Report {
+	c.running.Lock()
+	defer c.running.Unlock()
+
+	i := 0
+	if readiness {
+		i = 1
+	}
+
+	cached := &c.cached[i]
+	if cached.time.IsZero() || time.Since(cached.time) > reportTTL {
+		// not bound to the request, as the report is shared
+		cached.report = c.Run(context.Background(), readiness)
+		cached.time = time.Now()
+	}
+	return cached.report
+}
+
+func (c *Checks) handler(readiness, details bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.cachedRun(readiness)
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		if !details {
+			report = Report{Status: report.Status}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		err := json.NewEncoder(w).Encode(report)
+		if err != nil {
+			log.Printf("failed to write response: %s", err)
+		}
+	})
+}
+
+// Healthz reports the status of the liveness checks, responding with 503 if
+// any failed. The results of the single checks are not disclosed.
+func (c *Checks) Healthz() http.Handler {
+	return c.handler(false, false)
+}
+
+// Readyz reports the status of all checks, responding with 503 if any
+// failed. The results of the single checks are not disclosed.
+func (c *Checks) Readyz() http.Handler {
+	return c.handler(true, false)
+}
+
+// Details reports the results of all checks, including their errors, and
+// is meant to be restricted to admins
+func (c *Checks) Details() http.Handler {
+	return c.handler(true, true)
+}
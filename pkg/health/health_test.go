@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	var remoteChecks int32
+	c := New()
+	c.Liveness("webui", func(ctx context.Context) error {
+		return nil
+	})
+	c.Readiness("recaptcha", func(ctx context.Context) error {
+		atomic.AddInt32(&remoteChecks, 1)
+		return errors.New("unreachable")
+	})
+
+	for _, tc := range []struct {
+		handler http.Handler
+		code    int
+		checks  int
+	}{
+		{c.Healthz(), http.StatusOK, 0},
+		{c.Readyz(), http.StatusServiceUnavailable, 0},
+		{c.Details(), http.StatusServiceUnavailable, 2},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != tc.code {
+			t.Errorf("expected status %d, got %d", tc.code, w.Code)
+		}
+
+		var report Report
+		err := json.NewDecoder(w.Body).Decode(&report)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(report.Checks) != tc.checks {
+			t.Errorf("expected %d checks, got %+v", tc.checks, report.Checks)
+		}
+	}
+
+	// the readiness report is shared by Readyz and Details
+	if n := atomic.LoadInt32(&remoteChecks); n != 1 {
+		t.Errorf("expected checks to be cached, ran %d times", n)
+	}
+
+	report := c.Run(context.Background(), true)
+	if r := report.Checks["recaptcha"]; r.Status != StatusFail || r.Error != "unreachable" {
+		t.Errorf("unexpected recaptcha result: %+v", r)
+	}
+}
@@ -0,0 +1,405 @@
+// Package history keeps an append-only log of doorbell rings in a JSON lines
+// file. Rings, their results and acknowledgements are appended as separate
+// records as they happen and are merged when the log is queried.
+package history
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+// possible results of a ring
+const (
+	ResultPending     = "pending"
+	ResultOK          = "ok"
+	ResultError       = "error"
+	ResultClosed      = "closed"
+	ResultRateLimited = "rate-limited"
+	// the visitor failed to solve the captcha, so never got to ring
+	ResultCaptchaFailed = "captcha-failed"
+)
+
+// how often entries older than the retention period are pruned
+const pruneInterval = time.Hour
+
+// Entry describes a single attempt to ring the doorbell
+type Entry struct {
+	ID       string      `json:"id,omitempty"`
+	Time     time.Time   `json:"timestamp"`
+	Subject  string      `json:"subject,omitempty"`
+	IPHash   string      `json:"ip_hash,omitempty"`
+	Name     string      `json:"name,omitempty"`
+	Message  string      `json:"message,omitempty"`
+	Override bool        `json:"override,omitempty"`
+	Result   string      `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Ack      *ringer.Ack `json:"ack,omitempty"`
+}
+
+// record types stored in the log
+const (
+	recordRing   = "ring"
+	recordResult = "result"
+	recordAck    = "ack"
+)
+
+type record struct {
+	Type string `json:"type"`
+	Entry
+}
+
+type Config struct {
+	Path string
+	// Retention is how long entries are kept, zero keeps them forever
+	Retention time.Duration
+	// IPSalt is the key used to hash IP addresses. If empty, a random key
+	// is used, which means hashes change with every restart.
+	IPSalt []byte
+}
+
+type Log struct {
+	path      string
+	retention time.Duration
+	ipSalt    []byte
+	file      *os.File
+	mutex     sync.Mutex
+}
+
+func Open(c Config) (*Log, error) {
+	if len(c.Path) == 0 {
+		return nil, errors.New("history path must not be empty")
+	}
+
+	if c.Retention < 0 {
+		return nil, errors.New("history retention must not be negative")
+	}
+
+	salt := c.IPSalt
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := &Log{
+		path:      c.Path,
+		retention: c.Retention,
+		ipSalt:    salt,
+	}
+
+	err := l.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	return nil
+}
+
+// HashIP returns a keyed hash of the host part of a remote address, which
+// allows to recognize repeated visitors without storing their address
+func (l *Log) HashIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	mac := hmac.New(sha256.New, l.ipSalt)
+	mac.Write([]byte(host))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (l *Log) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Ring records an attempt to ring the doorbell
+func (l *Log) Ring(e Entry) error {
+	if len(e.Result) == 0 {
+		e.Result = ResultPending
+	}
+	return l.append(record{Type: recordRing, Entry: e})
+}
+
+// Result records the outcome of a previously recorded ring
+func (l *Log) Result(id string, result string, err error) error {
+	r := record{
+		Type: recordResult,
+		Entry: Entry{
+			ID:     id,
+			Time:   time.Now(),
+			Result: result,
+		},
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return l.append(r)
+}
+
+// Acknowledge records the acknowledgement of a previously recorded ring
+func (l *Log) Acknowledge(id string, a ringer.Ack) error {
+	return l.append(record{
+		Type: recordAck,
+		Entry: Entry{
+			ID:   id,
+			Time: a.Time,
+			Ack:  &a,
+		},
+	})
+}
+
+func (l *Log) readRecords() ([]record, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r record
+		err = json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// skip records corrupted e.g. by a crash while writing
+			continue
+		}
+		records = append(records, r)
+	}
+
+	return records, scanner.Err()
+}
+
+// Query returns all entries of rings between from and to (inclusive),
+// ordered by time. Zero times leave the range open.
+func (l *Log) Query(from, to time.Time) ([]Entry, error) {
+	l.mutex.Lock()
+	records, err := l.readRecords()
+	l.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	byID := make(map[string]int)
+	for _, r := range records {
+		switch r.Type {
+		case recordRing:
+			if !from.IsZero() && r.Time.Before(from) || !to.IsZero() && r.Time.After(to) {
+				continue
+			}
+			if len(r.ID) > 0 {
+				byID[r.ID] = len(entries)
+			}
+			entries = append(entries, r.Entry)
+		case recordResult:
+			if i, ok := byID[r.ID]; ok {
+				entries[i].Result = r.Result
+				entries[i].Error = r.Error
+			}
+		case recordAck:
+			if i, ok := byID[r.ID]; ok {
+				entries[i].Ack = r.Ack
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// Prune removes all records of rings older than the retention period
+func (l *Log) Prune(now time.Time) error {
+	if l.retention == 0 {
+		return nil
+	}
+	cutoff := now.Add(-l.retention)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	records, err := l.readRecords()
+	if err != nil {
+		return err
+	}
+
+	expired := make(map[string]bool)
+	var kept []record
+	for _, r := range records {
+		if r.Type == recordRing && r.Time.Before(cutoff) {
+			if len(r.ID) > 0 {
+				expired[r.ID] = true
+			}
+			continue
+		}
+		if r.Type != recordRing && expired[r.ID] {
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	if len(kept) == len(records) {
+		return nil
+	}
+
+	tmp, err := os.OpenFile(filepath.Join(filepath.Dir(l.path), "."+filepath.Base(l.path)+".tmp"),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, r := range kept {
+		line, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), l.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	l.file.Close()
+	return l.open()
+}
+
+// RunPruning prunes the log periodically until the context is cancelled
+func (l *Log) RunPruning(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		err := l.Prune(time.Now())
+		if err != nil {
+			log.Printf("failed to prune ring history: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check verifies that the log file is still in place, i.e. was not removed
+// or replaced since it has been opened
+func (l *Log) Check(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	opened, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	current, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(opened, current) {
+		return fmt.Errorf("%s was replaced since it has been opened", l.path)
+	}
+
+	return nil
+}
+
+// csvValue protects against values being interpreted as formulas by
+// spreadsheet applications
+func csvValue(s string) string {
+	if len(s) > 0 && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// WriteCSV exports entries as CSV with a header row
+func WriteCSV(w io.Writer, entries []Entry) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{
+		"id", "timestamp", "subject", "ip_hash", "name", "message", "result", "error",
+		"ack_by", "ack_reply", "ack_timestamp", "ack_message",
+	})
+
+	for _, e := range entries {
+		row := []string{
+			e.ID, e.Time.Format(time.RFC3339), e.Subject, e.IPHash, e.Name, e.Message, e.Result, e.Error,
+			"", "", "", "",
+		}
+		if e.Ack != nil {
+			row[8] = e.Ack.By
+			row[9] = e.Ack.Reply
+			row[10] = e.Ack.Time.Format(time.RFC3339)
+			row[11] = e.Ack.Message
+		}
+
+		for i := range row {
+			row[i] = csvValue(row[i])
+		}
+		c.Write(row)
+	}
+
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+func openLog(t *testing.T, retention time.Duration) (*Log, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(Config{
+		Path:      filepath.Join(dir, "rings.jsonl"),
+		Retention: retention,
+		IPSalt:    []byte("salt"),
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return l, func() { os.RemoveAll(dir) }
+}
+
+func TestQuery(t *testing.T) {
+	l, cleanup := openLog(t, 0)
+	defer cleanup()
+
+	now := time.Now()
+	l.Ring(Entry{Time: now.Add(-2 * time.Hour), Result: ResultClosed})
+	l.Ring(Entry{ID: "a", Time: now.Add(-time.Hour), Subject: "Anonymous", IPHash: l.HashIP("192.0.2.1:1234"), Message: "hello"})
+	l.Ring(Entry{ID: "b", Time: now})
+	l.Result("a", ResultOK, nil)
+	l.Result("b", ResultError, errors.New("speaker on fire"))
+	l.Acknowledge("a", ringer.Ack{By: "Anna", Reply: ringer.ReplyComing, Time: now})
+
+	entries, err := l.Query(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	a := entries[1]
+	if a.ID != "a" || a.Result != ResultOK || a.Message != "hello" || a.Ack == nil || a.Ack.By != "Anna" {
+		t.Errorf("unexpected entry: %+v", a)
+	}
+
+	if a.IPHash != l.HashIP("192.0.2.1:5678") || a.IPHash == l.HashIP("192.0.2.2:1234") {
+		t.Errorf("ip hash does not identify the host")
+	}
+
+	if b := entries[2]; b.Result != ResultError || b.Error != "speaker on fire" {
+		t.Errorf("unexpected entry: %+v", b)
+	}
+
+	entries, err = l.Query(now.Add(-90*time.Minute), now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].ID != "a" {
+		t.Errorf("unexpected entries in range: %+v", entries)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, cleanup := openLog(t, 24*time.Hour)
+	defer cleanup()
+
+	now := time.Now()
+	l.Ring(Entry{ID: "old", Time: now.Add(-48 * time.Hour)})
+	l.Result("old", ResultOK, nil)
+	l.Ring(Entry{ID: "new", Time: now})
+
+	err := l.Prune(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the log is still writable after pruning
+	l.Result("new", ResultOK, nil)
+
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected 2 records after pruning, got %d", lines)
+	}
+
+	entries, err := l.Query(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].ID != "new" || entries[0].Result != ResultOK {
+		t.Errorf("unexpected entries after pruning: %+v", entries)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, []Entry{{
+		ID:      "a",
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Message: "=HYPERLINK(\"http://evil\")",
+		Result:  ResultOK,
+		Ack:     &ringer.Ack{By: "Anna", Reply: ringer.ReplyComing, Time: time.Date(2020, 1, 2, 3, 5, 0, 0, time.UTC)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got %q", buf.String())
+	}
+
+	expected := `a,2020-01-02T03:04:05Z,,,,"'=HYPERLINK(""http://evil"")",ok,,Anna,coming,2020-01-02T03:05:00Z,`
+	if lines[1] != expected {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	// a monday
+	monday := time.Date(2021, 3, 1, 14, 30, 0, 0, time.UTC)
+
+	entries := []Entry{
+		{ID: "a", Time: monday, Result: ResultOK},
+		{ID: "b", Time: monday.Add(10 * time.Minute), Result: ResultError},
+		{ID: "c", Time: monday.Add(6*24*time.Hour + 9*time.Hour), Result: ResultPending},
+		{Time: monday, Result: ResultClosed},
+		{Time: monday, Result: ResultRateLimited},
+		{Time: monday, Result: ResultCaptchaFailed},
+		{Time: monday, Result: ResultCaptchaFailed},
+	}
+
+	s := Aggregate(entries, time.Time{}, time.Time{}, time.UTC)
+	if s.Rings != 3 || s.Closed != 1 || s.RateLimited != 1 || s.CaptchaFailed != 2 {
+		t.Errorf("unexpected counts: %+v", s)
+	}
+
+	if s.HourOfWeek[0][14] != 2 || s.HourOfWeek[6][23] != 1 {
+		t.Errorf("unexpected hour of week buckets: %v", s.HourOfWeek)
+	}
+
+	var svg bytes.Buffer
+	err := s.WriteSVG(&svg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(svg.String(), `fill="#0099ff" stroke="#f2f2f2"><title>Mon 14:00: 2 rings</title>`) {
+		t.Errorf("busiest hour is not highlighted in heatmap")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	l, cleanup := openLog(t, 0)
+	defer cleanup()
+
+	now := time.Now()
+	l.Ring(Entry{ID: "old", Time: now.Add(-25 * time.Hour), Result: ResultPending})
+	l.Ring(Entry{Time: now.Add(-time.Hour), Result: ResultClosed})
+	l.Ring(Entry{ID: "a", Time: now.Add(-time.Hour), Result: ResultPending})
+	l.Ring(Entry{ID: "b", Time: now.Add(-time.Minute), Override: true, Result: ResultPending})
+	l.Acknowledge("b", ringer.Ack{By: "Anna", Reply: ringer.ReplyComing, Time: now})
+
+	d, err := l.Digest(now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Rings != 2 || d.Overrides != 1 || d.Acknowledged != 1 {
+		t.Errorf("unexpected digest: %+v", d)
+	}
+}
@@ -0,0 +1,130 @@
+package history
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+// Stats aggregates the ring history
+type Stats struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// HourOfWeek counts accepted rings by weekday (starting on Monday) and
+	// hour of the day
+	HourOfWeek    [7][24]int `json:"hour_of_week"`
+	Rings         int        `json:"rings"`
+	Closed        int        `json:"closed"`
+	RateLimited   int        `json:"rate_limited"`
+	CaptchaFailed int        `json:"captcha_failed"`
+}
+
+// Aggregate computes the statistics of the given entries, bucketing rings
+// by their local time in loc
+func Aggregate(entries []Entry, from, to time.Time, loc *time.Location) Stats {
+	s := Stats{From: from, To: to}
+
+	for _, e := range entries {
+		switch e.Result {
+		case ResultClosed:
+			s.Closed++
+		case ResultRateLimited:
+			s.RateLimited++
+		case ResultCaptchaFailed:
+			s.CaptchaFailed++
+		default:
+			t := e.Time.In(loc)
+			day := (int(t.Weekday()) + 6) % 7
+			s.HourOfWeek[day][t.Hour()]++
+			s.Rings++
+		}
+	}
+
+	return s
+}
+
+// Digest summarizes the accepted rings between from and to for the daily
+// mail digest
+func (l *Log) Digest(from, to time.Time) (ringer.Digest, error) {
+	entries, err := l.Query(from, to)
+	if err != nil {
+		return ringer.Digest{}, err
+	}
+
+	d := ringer.Digest{From: from, To: to}
+	for _, e := range entries {
+		switch e.Result {
+		case ResultClosed, ResultRateLimited, ResultCaptchaFailed:
+			continue
+		}
+
+		d.Rings++
+		if e.Override {
+			d.Overrides++
+		}
+		if e.Ack != nil {
+			d.Acknowledged++
+		}
+	}
+
+	return d, nil
+}
+
+var weekdays = [7]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+const (
+	heatmapCell   = 20
+	heatmapLeft   = 40
+	heatmapTop    = 20
+	heatmapWidth  = heatmapLeft + 24*heatmapCell
+	heatmapHeight = heatmapTop + 7*heatmapCell
+)
+
+// heatColor interpolates between white and the doorbell blue
+func heatColor(count, max int) string {
+	if max == 0 {
+		max = 1
+	}
+	f := float64(count) / float64(max)
+	r := 255 - int(f*255)
+	g := 255 - int(f*(255-0x99))
+	return fmt.Sprintf("#%02x%02xff", r, g)
+}
+
+// WriteSVG renders the rings per hour of the week as SVG heatmap
+func (s Stats) WriteSVG(w io.Writer) error {
+	max := 0
+	for _, hours := range s.HourOfWeek {
+		for _, count := range hours {
+			if count > max {
+				max = count
+			}
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="10">`+"\n",
+		heatmapWidth, heatmapHeight, heatmapWidth, heatmapHeight)
+
+	for hour := 0; hour < 24; hour += 3 {
+		fmt.Fprintf(b, `<text x="%d" y="%d">%02d</text>`+"\n", heatmapLeft+hour*heatmapCell+3, heatmapTop-6, hour)
+	}
+
+	for day, hours := range s.HourOfWeek {
+		y := heatmapTop + day*heatmapCell
+		fmt.Fprintf(b, `<text x="0" y="%d">%s</text>`+"\n", y+heatmapCell-6, weekdays[day])
+
+		for hour, count := range hours {
+			fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#f2f2f2">`+
+				`<title>%s %02d:00: %d rings</title></rect>`+"\n",
+				heatmapLeft+hour*heatmapCell, y, heatmapCell, heatmapCell, heatColor(count, max),
+				weekdays[day], hour, count)
+		}
+	}
+
+	fmt.Fprintln(b, `</svg>`)
+	return b.Flush()
+}
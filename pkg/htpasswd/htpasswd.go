@@ -0,0 +1,140 @@
+// Package htpasswd authenticates users against password files created by
+// htpasswd -B. Only bcrypt hashes are supported.
+package htpasswd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// File is a password file, which is reloaded when it is modified
+type File struct {
+	path    string
+	modTime time.Time
+	hashes  map[string][]byte
+	// dummy is compared for unknown users, so they take as long to reject
+	// as known users with a wrong password. It has the highest cost of all
+	// hashes in the file.
+	dummy []byte
+	mutex sync.Mutex
+}
+
+func Open(path string) (*File, error) {
+	f := &File{path: path}
+	err := f.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// dummyHash generates a hash with the highest cost of the given hashes
+func dummyHash(hashes map[string][]byte) ([]byte, error) {
+	cost := bcrypt.MinCost
+	for _, hash := range hashes {
+		if c, _ := bcrypt.Cost(hash); c > cost {
+			cost = c
+		}
+	}
+	return bcrypt.GenerateFromPassword([]byte("dummy"), cost)
+}
+
+func parse(path string) (map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, line)
+		}
+
+		user, hash := parts[0], []byte(parts[1])
+		if _, err = bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: unsupported hash of user %q (create it with htpasswd -B): %s",
+				path, line, user, err)
+		}
+
+		hashes[user] = hash
+	}
+
+	return hashes, scanner.Err()
+}
+
+// reload parses the file if it was modified since it was last read
+func (f *File) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	if f.hashes != nil && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	hashes, err := parse(f.path)
+	if err != nil {
+		return err
+	}
+
+	dummy, err := dummyHash(hashes)
+	if err != nil {
+		return err
+	}
+
+	f.hashes = hashes
+	f.dummy = dummy
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Authenticate verifies the password of a user
+func (f *File) Authenticate(user, password string) error {
+	f.mutex.Lock()
+	err := f.reload()
+	if err != nil {
+		// keep the users which were read before
+		log.Printf("failed to reload password file: %s", err)
+	}
+	hash, ok := f.hashes[user]
+	dummy := f.dummy
+	f.mutex.Unlock()
+
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummy, []byte(password))
+		return ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// Check verifies that the password file is still readable and valid
+func (f *File) Check(ctx context.Context) error {
+	_, err := parse(f.path)
+	return err
+}
@@ -0,0 +1,93 @@
+package htpasswd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const users = `# created with htpasswd -B
+anna:$2y$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW
+
+bob:$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK
+`
+
+func TestAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users")
+	err = ioutil.WriteFile(path, []byte(users), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		err            error
+	}{
+		{"anna", "U*U", nil},
+		{"bob", "U*U*", nil},
+		{"bob", "U*U", ErrInvalidCredentials},
+		{"carol", "U*U", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		if err := f.Authenticate(tt.user, tt.password); err != tt.err {
+			t.Errorf("%s: expected %v, got %v", tt.user, tt.err, err)
+		}
+	}
+
+	if cost, _ := bcrypt.Cost(f.dummy); cost != 5 {
+		t.Errorf("expected dummy hash to have the cost of the users, got %d", cost)
+	}
+
+	// modifications are picked up, invalid ones are ignored
+	err = ioutil.WriteFile(path, []byte("anna:$apr1$abc$def\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+
+	if err = f.Check(context.Background()); err == nil {
+		t.Error("md5 hash was not reported")
+	}
+
+	if err = f.Authenticate("anna", "U*U"); err != nil {
+		t.Errorf("users were lost after invalid modification: %s", err)
+	}
+
+	err = ioutil.WriteFile(path, []byte("bob:$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+
+	if err = f.Authenticate("anna", "U*U"); err != ErrInvalidCredentials {
+		t.Errorf("removed user was accepted: %v", err)
+	}
+
+	err = ioutil.WriteFile(path, []byte("bob:$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s.\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(3*time.Second))
+
+	f.Authenticate("carol", "U*U")
+	if cost, _ := bcrypt.Cost(f.dummy); cost != 6 {
+		t.Errorf("dummy hash was not regenerated on reload, cost %d", cost)
+	}
+}
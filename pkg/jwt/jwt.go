@@ -19,6 +19,7 @@ type Claims struct {
 	Subject   string `json:"sub,omitempty"`
 	IssuedAt  int64  `json:"iat,omitempty"`
 	ExpiresAt int64  `json:"exp,omitempty"`
+	Role      string `json:"role,omitempty"`
 }
 
 const jwtAlgorithm = "HS256"
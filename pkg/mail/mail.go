@@ -0,0 +1,208 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Addr is the host:port of the SMTP server
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	// TLSConfig is used for STARTTLS, which is required unless connecting
+	// to localhost
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// Mailer sends multipart text and HTML mails via SMTP
+type Mailer struct {
+	addr      string
+	host      string
+	username  string
+	password  string
+	from      string
+	to        []string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+func New(c Config) (*Mailer, error) {
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.From) == 0 {
+		return nil, errors.New("mail sender is empty")
+	}
+
+	if len(c.To) == 0 {
+		return nil, errors.New("mail recipients are empty")
+	}
+
+	tlsConfig := &tls.Config{ServerName: host}
+	if c.TLSConfig != nil {
+		tlsConfig = c.TLSConfig
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &Mailer{
+		addr:      c.Addr,
+		host:      host,
+		username:  c.Username,
+		password:  c.Password,
+		from:      c.From,
+		to:        c.To,
+		tlsConfig: tlsConfig,
+		timeout:   timeout,
+	}, nil
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// Send delivers a mail with a plain text and an HTML alternative to all
+// configured recipients
+func (m *Mailer) Send(ctx context.Context, subject, text, html string) error {
+	msg, err := m.compose(subject, text, html)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(m.tlsConfig)
+		if err != nil {
+			return err
+		}
+	} else if !isLocalhost(m.host) {
+		return errors.New("smtp server does not support STARTTLS")
+	}
+
+	if len(m.username) > 0 {
+		err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(m.from)
+	if err != nil {
+		return err
+	}
+
+	for _, to := range m.to {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writePart(buf *bytes.Buffer, boundary, contentType, body string) error {
+	fmt.Fprintf(buf, "--%s\r\n", boundary)
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	fmt.Fprintf(buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(buf)
+	_, err := qp.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+
+	err = qp.Close()
+	buf.WriteString("\r\n")
+	return err
+}
+
+func (m *Mailer) compose(subject, text, html string) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	err = writePart(&buf, boundary, "text/plain", text)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writePart(&buf, boundary, "text/html", html)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
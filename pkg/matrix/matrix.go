@@ -0,0 +1,134 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Homeserver  string
+	AccessToken string
+	Client      *http.Client
+}
+
+// Client is a minimal Matrix client-server API client for sending messages
+type Client struct {
+	homeserver  string
+	accessToken string
+	client      *http.Client
+}
+
+type RelatesTo struct {
+	InReplyTo *InReplyTo `json:"m.in_reply_to,omitempty"`
+}
+
+type InReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+// Message is the content of an m.room.message event
+type Message struct {
+	MsgType   string     `json:"msgtype"`
+	Body      string     `json:"body"`
+	RelatesTo *RelatesTo `json:"m.relates_to,omitempty"`
+}
+
+type Error struct {
+	StatusCode   int    `json:"-"`
+	ErrCode      string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix homeserver returned %d %s: %s", e.StatusCode, e.ErrCode, e.Message)
+}
+
+func New(c Config) *Client {
+	if len(c.Homeserver) == 0 {
+		panic("matrix homeserver is empty")
+	}
+
+	if len(c.AccessToken) == 0 {
+		panic("matrix access token is empty")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Client{
+		homeserver:  strings.TrimRight(c.Homeserver, "/"),
+		accessToken: c.AccessToken,
+		client:      client,
+	}
+}
+
+type sendResponse struct {
+	EventID string `json:"event_id"`
+}
+
+// SendMessage sends an m.room.message event to a room. The transaction ID
+// makes the request idempotent, resending with the same ID is a no-op.
+func (c *Client) SendMessage(ctx context.Context, roomID, txnID string, m Message) (string, error) {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		url.PathEscape(roomID), url.PathEscape(txnID))
+
+	var resp sendResponse
+	err := c.put(ctx, path, m, &resp)
+	if e, ok := err.(*Error); ok && e.ErrCode == "M_LIMIT_EXCEEDED" {
+		// retry once after being rate limited
+		select {
+		case <-time.After(time.Duration(e.RetryAfterMs) * time.Millisecond):
+			err = c.put(ctx, path, m, &resp)
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.EventID) == 0 {
+		return "", errors.New("matrix homeserver returned no event id")
+	}
+
+	return resp.EventID, nil
+}
+
+func (c *Client) put(ctx context.Context, path string, body interface{}, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.homeserver+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,345 @@
+// Package metrics implements counters, gauges and histograms which are
+// exposed in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suited to latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics, each registered under a unique name
+type Registry struct {
+	metrics map[string]metric
+	mutex   sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]metric),
+	}
+}
+
+// Default is the registry used by the package level functions
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText writes all metrics in the text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mutex.Unlock()
+
+	b := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(b)
+	}
+	return b.Flush()
+}
+
+// Handler serves the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		err := r.WriteText(w)
+		if err != nil {
+			log.Printf("failed to write metrics: %s", err)
+		}
+	})
+}
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.kind)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats label pairs, including an optional extra pair
+func (d *desc) formatLabels(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labels[i], labelValueEscaper.Replace(v)))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[0], extra[1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// vec keeps the series of a metric by their label values
+type vec struct {
+	desc
+	series map[string]interface{}
+	values map[string][]string
+	mutex  sync.Mutex
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{
+		desc:   desc{name: name, help: help, kind: kind, labels: labels},
+		series: make(map[string]interface{}),
+		values: make(map[string][]string),
+	}
+}
+
+func (v *vec) with(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = create()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// each calls f for all series, ordered by their label values
+func (v *vec) each(f func(values []string, s interface{})) {
+	v.mutex.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]interface{}, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+		values[i] = v.values[key]
+	}
+	v.mutex.Unlock()
+
+	for i := range series {
+		f(values[i], series[i])
+	}
+}
+
+// Counter is a value which only ever increases
+type Counter struct {
+	value float64
+	mutex sync.Mutex
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counters cannot decrease")
+	}
+
+	c.mutex.Lock()
+	c.value += delta
+	c.mutex.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.value
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vec
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// With returns the counter for the given label values
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.each(func(values []string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(values), formatFloat(s.(*Counter).get()))
+	})
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct {
+	desc
+	value float64
+	mutex sync.Mutex
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge"}}
+	r.register(name, g)
+	return g
+}
+
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mutex.Lock()
+	g.value = value
+	g.mutex.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mutex.Lock()
+	value := g.value
+	g.mutex.Unlock()
+
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(value))
+}
+
+// Histogram counts observations in configurable buckets
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64
+	count       uint64
+	sum         float64
+	mutex       sync.Mutex
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+
+	h := &HistogramVec{
+		vec:     newVec(name, help, "histogram", labels),
+		buckets: buckets,
+	}
+	r.register(name, h)
+	return h
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// With returns the histogram for the given label values
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values, func() interface{} {
+		return &Histogram{
+			upperBounds: h.buckets,
+			counts:      make([]uint64, len(h.buckets)),
+		}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.each(func(values []string, s interface{}) {
+		hist := s.(*Histogram)
+		hist.mutex.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mutex.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(values), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(values), count)
+	})
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	rings := r.NewCounterVec("rings_total", "Rings by reason.", "reason")
+	rings.With("ok").Inc()
+	rings.With("ok").Inc()
+	rings.With("closed").Add(3)
+	rings.With(`we"ird` + "\n").Inc()
+
+	open := r.NewGauge("open", "Whether the doorbell is open.")
+	open.Set(1)
+
+	scores := r.NewHistogramVec("score", "Scores.\nMultiline help.", []float64{0.5, 1})
+	scores.With().Observe(0.3)
+	scores.With().Observe(0.9)
+	scores.With().Observe(7)
+
+	var buf bytes.Buffer
+	err := r.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP open Whether the doorbell is open.
+# TYPE open gauge
+open 1
+# HELP rings_total Rings by reason.
+# TYPE rings_total counter
+rings_total{reason="closed"} 3
+rings_total{reason="ok"} 2
+rings_total{reason="we\"ird\n"} 1
+# HELP score Scores.\nMultiline help.
+# TYPE score histogram
+score_bucket{le="0.5"} 1
+score_bucket{le="1"} 2
+score_bucket{le="+Inf"} 3
+score_sum 8.2
+score_count 3
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected exposition:\n%s", buf.String())
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a metric twice did not panic")
+		}
+	}()
+
+	r := NewRegistry()
+	r.NewGauge("open", "")
+	r.NewGauge("open", "")
+}
+
+func TestInstrumentRoute(t *testing.T) {
+	h := InstrumentRoute("/teapot", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.(http.Flusher).Flush()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/teapot", nil))
+
+	var buf bytes.Buffer
+	Default.WriteText(&buf)
+	if !strings.Contains(buf.String(), `doorbell_http_request_duration_seconds_count{route="/teapot",code="418"} 1`) {
+		t.Errorf("request was not recorded:\n%s", buf.String())
+	}
+}
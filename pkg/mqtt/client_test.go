@@ -0,0 +1,214 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type published struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+	dup     bool
+}
+
+// fakeBroker is an in-process stand-in for an MQTT broker
+type fakeBroker struct {
+	listener net.Listener
+	// number of publishes after which the connection is dropped unacknowledged
+	dropAfter int
+
+	mutex     sync.Mutex
+	connects  []string
+	published []published
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &fakeBroker{listener: l}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	p, err := readPacket(r)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+
+	// skip protocol name, level, flags and keep alive
+	_, rest, _ := readString(p.payload)
+	clientID, rest, _ := readString(rest[4:])
+	username, _, _ := readString(rest)
+
+	b.mutex.Lock()
+	b.connects = append(b.connects, clientID+":"+username)
+	b.mutex.Unlock()
+
+	writePacket(conn, packet{kind: packetConnack, payload: []byte{0, 0}})
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p.kind {
+		case packetPublish:
+			qos := (p.flags >> 1) & 0x03
+			topic, rest, _ := readString(p.payload)
+			var id uint16
+			if qos > 0 {
+				id, rest, _ = readUint16(rest)
+			}
+
+			b.mutex.Lock()
+			b.published = append(b.published, published{
+				topic:   topic,
+				payload: string(rest),
+				qos:     qos,
+				retain:  p.flags&0x01 != 0,
+				dup:     p.flags&0x08 != 0,
+			})
+			drop := b.dropAfter > 0 && len(b.published) == b.dropAfter
+			b.mutex.Unlock()
+
+			if drop {
+				return
+			}
+
+			if qos > 0 {
+				writePacket(conn, packet{kind: packetPuback, payload: appendUint16(nil, id)})
+			}
+		case packetPingreq:
+			writePacket(conn, packet{kind: packetPingresp})
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) Published() []published {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]published(nil), b.published...)
+}
+
+func (b *fakeBroker) Connects() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string(nil), b.connects...)
+}
+
+func newTestClient(t *testing.T, b *fakeBroker) *Client {
+	c, err := New(Config{
+		Broker:    "tcp://bell:secret@" + b.listener.Addr().String(),
+		ClientID:  "doorbell-test",
+		KeepAlive: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPublish(t *testing.T) {
+	b := newFakeBroker(t)
+	defer b.listener.Close()
+
+	c := newTestClient(t, b)
+	defer c.Close()
+
+	ctx := context.Background()
+	err := c.Publish(ctx, "doorbell/ring", []byte(`{"id":"1"}`), 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Publish(ctx, "doorbell/ring", []byte(`{"id":"2"}`), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// qos 0 is not acknowledged, give the broker a moment
+	time.Sleep(50 * time.Millisecond)
+
+	p := b.Published()
+	if len(p) != 2 {
+		t.Fatalf("expected 2 published messages, got %d", len(p))
+	}
+
+	if p[0].topic != "doorbell/ring" || p[0].payload != `{"id":"1"}` || p[0].qos != 1 || !p[0].retain {
+		t.Errorf("unexpected first message: %+v", p[0])
+	}
+
+	if p[1].payload != `{"id":"2"}` || p[1].qos != 0 || p[1].retain {
+		t.Errorf("unexpected second message: %+v", p[1])
+	}
+
+	connects := b.Connects()
+	if len(connects) != 1 || connects[0] != "doorbell-test:bell" {
+		t.Errorf("unexpected connects: %v", connects)
+	}
+}
+
+func TestPublishReconnect(t *testing.T) {
+	b := newFakeBroker(t)
+	b.dropAfter = 1
+	defer b.listener.Close()
+
+	c := newTestClient(t, b)
+	defer c.Close()
+
+	err := c.Publish(context.Background(), "doorbell/ring", []byte("ring"), 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := b.Published()
+	if len(p) != 2 || p[0].dup || !p[1].dup {
+		t.Errorf("expected message to be redelivered with dup flag: %+v", p)
+	}
+
+	if len(b.Connects()) != 2 {
+		t.Errorf("expected client to reconnect, got %d connects", len(b.Connects()))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	_, err := New(Config{Broker: "http://localhost", KeepAlive: time.Minute})
+	if err == nil {
+		t.Error("accepted unsupported scheme")
+	}
+
+	c, err := New(Config{Broker: "mqtts://broker.example.org", KeepAlive: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.address != "broker.example.org:8883" || c.tlsConfig == nil || c.tlsConfig.ServerName != "broker.example.org" {
+		t.Errorf("unexpected tls client configuration: %s", c.address)
+	}
+}
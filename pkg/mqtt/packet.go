@@ -0,0 +1,111 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// control packet types of MQTT 3.1.1
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+const maxRemainingLength = 268435455
+
+type packet struct {
+	kind    byte
+	flags   byte
+	payload []byte
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func writePacket(w io.Writer, p packet) error {
+	if len(p.payload) > maxRemainingLength {
+		return errors.New("mqtt packet too large")
+	}
+
+	header := []byte{p.kind<<4 | p.flags&0x0f}
+
+	// remaining length is encoded as variable length integer
+	length := len(p.payload)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		header = append(header, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(header, p.payload...))
+	return err
+}
+
+func readPacket(r *bufio.Reader) (p packet, err error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return p, err
+	}
+	p.kind = first >> 4
+	p.flags = first & 0x0f
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return p, errors.New("malformed mqtt remaining length")
+		}
+
+		digit, err := r.ReadByte()
+		if err != nil {
+			return p, err
+		}
+
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	p.payload = make([]byte, length)
+	_, err = io.ReadFull(r, p.payload)
+	return p, err
+}
+
+func readUint16(b []byte) (uint16, []byte, error) {
+	if len(b) < 2 {
+		return 0, b, errors.New("malformed mqtt packet")
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	n, b, err := readUint16(b)
+	if err != nil {
+		return "", b, err
+	}
+
+	if len(b) < int(n) {
+		return "", b, errors.New("malformed mqtt string")
+	}
+	return string(b[:n]), b[n:], nil
+}
@@ -0,0 +1,94 @@
+package ntfy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// TopicURL is the URL of the topic to publish to, e.g. https://ntfy.sh/mytopic
+	TopicURL string
+	// Token is used for bearer authentication, if set
+	Token string
+	// Username and Password are used for basic authentication, if set
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// Client publishes messages to an ntfy compatible server
+type Client struct {
+	topicURL string
+	token    string
+	username string
+	password string
+	client   *http.Client
+}
+
+type Message struct {
+	Title    string
+	Body     string
+	Priority string
+	Tags     []string
+	Click    string
+}
+
+func New(c Config) *Client {
+	if len(c.TopicURL) == 0 {
+		panic("ntfy topic url is empty")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Client{
+		topicURL: c.TopicURL,
+		token:    c.Token,
+		username: c.Username,
+		password: c.Password,
+		client:   client,
+	}
+}
+
+func (c *Client) Publish(ctx context.Context, m Message) error {
+	req, err := http.NewRequest(http.MethodPost, c.topicURL, strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+
+	setHeader := func(key, value string) {
+		if len(value) > 0 {
+			req.Header.Set(key, value)
+		}
+	}
+	setHeader("Title", m.Title)
+	setHeader("Priority", m.Priority)
+	setHeader("Tags", strings.Join(m.Tags, ","))
+	setHeader("Click", m.Click)
+
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if len(c.username) > 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ntfy server returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the only signature algorithm which is supported
+const algorithm = "RS256"
+
+// leeway for clock differences with the provider
+const leeway = time.Minute
+
+// audience is either a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+// IDToken is a verified id token
+type IDToken struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	claims            map[string]json.RawMessage
+}
+
+// Strings returns a claim holding either a string or an array of strings,
+// such as the groups of the user
+func (t *IDToken) Strings(name string) []string {
+	raw, ok := t.claims[name]
+	if !ok {
+		return nil
+	}
+
+	var list audience
+	if json.Unmarshal(raw, &list) != nil {
+		return nil
+	}
+	return list
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Verify checks the signature and the claims of an id token issued for us
+// in response to an authentication request with the given nonce
+func (p *Provider) Verify(ctx context.Context, raw, nonce string, now time.Time) (*IDToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token header: %s", err)
+	}
+
+	if header.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported id token algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token signature: %s", err)
+	}
+
+	key, err := p.key(ctx, header.KeyID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, errors.New("invalid id token signature")
+	}
+
+	var token IDToken
+	err = decodeSegment(parts[1], &token)
+	if err == nil {
+		err = decodeSegment(parts[1], &token.claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed id token claims: %s", err)
+	}
+
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validate(&token, m.Issuer, nonce, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (p *Provider) validate(t *IDToken, issuer, nonce string, now time.Time) error {
+	if strings.TrimSuffix(t.Issuer, "/") != issuer {
+		return fmt.Errorf("id token issued by %q", t.Issuer)
+	}
+
+	found := false
+	for _, aud := range t.Audience {
+		found = found || aud == p.clientID
+	}
+	if !found {
+		return errors.New("id token was not issued for this client")
+	}
+
+	if len(t.AuthorizedParty) > 0 && t.AuthorizedParty != p.clientID {
+		return errors.New("id token was issued to another party")
+	}
+
+	if len(t.Subject) == 0 {
+		return errors.New("id token has no subject")
+	}
+
+	if now.After(time.Unix(t.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("id token has expired")
+	}
+
+	if time.Unix(t.IssuedAt, 0).After(now.Add(leeway)) {
+		return errors.New("id token was issued in the future")
+	}
+
+	if len(nonce) == 0 || t.Nonce != nonce {
+		return errors.New("id token nonce does not match")
+	}
+
+	return nil
+}
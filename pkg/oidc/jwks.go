@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// keys are not refetched more often, even if tokens with unknown key ids
+// are presented
+const minKeysRefresh = time.Minute
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// keySet caches the signing keys of the provider
+type keySet struct {
+	ttl     time.Duration
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+	mutex   sync.Mutex
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus of key %q: %s", k.KeyID, err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent of key %q: %s", k.KeyID, err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent of key %q", k.KeyID)
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("key %q is shorter than 2048 bits", k.KeyID)
+	}
+
+	return key, nil
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, uri string) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := p.getJSON(ctx, uri, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		// other key types and encryption keys are not used for id tokens
+		if k.KeyType != "RSA" || (len(k.Use) > 0 && k.Use != "sig") ||
+			(len(k.Algorithm) > 0 && k.Algorithm != algorithm) {
+			continue
+		}
+
+		key, err := parseRSAKey(k)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.KeyID] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("provider has no RS256 signing keys")
+	}
+
+	return keys, nil
+}
+
+// key returns the signing key with the given id, refetching the keys if
+// they are outdated or the key is unknown, e.g. after a key rotation
+func (p *Provider) key(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := p.keys
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lookup := func() *rsa.PublicKey {
+		if key, ok := s.keys[kid]; ok {
+			return key
+		}
+
+		// tokens without key id are accepted if there is a single key
+		if len(kid) == 0 && len(s.keys) == 1 {
+			for _, key := range s.keys {
+				return key
+			}
+		}
+		return nil
+	}
+
+	key := lookup()
+	expired := now.Sub(s.fetched) >= s.ttl
+	if (key == nil && now.Sub(s.fetched) >= minKeysRefresh) || expired {
+		keys, err := p.fetchKeys(ctx, m.JWKSURI)
+		if err != nil {
+			if key != nil {
+				// keep using the cached key if the provider is unreachable
+				return key, nil
+			}
+			return nil, fmt.Errorf("failed to fetch signing keys: %s", err)
+		}
+
+		s.keys = keys
+		s.fetched = now
+		key = lookup()
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,259 @@
+// Package oidc implements the authorization code flow of OpenID Connect
+// with PKCE, as a client of providers such as Keycloak or Authentik.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maximum size of documents fetched from the provider
+const maxResponse = 1 << 20
+
+type Config struct {
+	// Issuer is the URL of the provider, as found in its id tokens
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider returns the authorization code
+	RedirectURL string
+	// Scopes are requested in addition to openid
+	Scopes []string
+	// Client defaults to a client with a timeout of 10 seconds
+	Client *http.Client
+	// KeysTTL is how long the signing keys are cached, defaults to one hour
+	KeysTTL time.Duration
+}
+
+// metadata is the discovery document of the provider
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is discovered lazily, so the provider does not need to be
+// reachable at startup
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+	metadata     *metadata
+	keys         *keySet
+	mutex        sync.Mutex
+}
+
+func New(c Config) *Provider {
+	if len(c.Issuer) == 0 {
+		panic("oidc issuer must not be empty")
+	}
+
+	if len(c.ClientID) == 0 {
+		panic("oidc client id must not be empty")
+	}
+
+	if len(c.RedirectURL) == 0 {
+		panic("oidc redirect url must not be empty")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	ttl := c.KeysTTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	return &Provider{
+		issuer:       strings.TrimSuffix(c.Issuer, "/"),
+		clientID:     c.ClientID,
+		clientSecret: c.ClientSecret,
+		redirectURL:  c.RedirectURL,
+		scopes:       append([]string{"openid"}, c.Scopes...),
+		client:       client,
+		keys:         &keySet{ttl: ttl},
+	}
+}
+
+func (p *Provider) getJSON(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", uri, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(v)
+}
+
+func (p *Provider) fetchMetadata(ctx context.Context) (*metadata, error) {
+	var m metadata
+	err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &m)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(m.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovered issuer %q does not match %q", m.Issuer, p.issuer)
+	}
+
+	if len(m.AuthorizationEndpoint) == 0 || len(m.TokenEndpoint) == 0 || len(m.JWKSURI) == 0 {
+		return nil, errors.New("discovery document lacks required endpoints")
+	}
+
+	m.Issuer = p.issuer
+	return &m, nil
+}
+
+// discover returns the cached discovery document, fetching it on first use
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	m, err := p.fetchMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %s", err)
+	}
+
+	p.metadata = m
+	return m, nil
+}
+
+// Check reports whether the provider is reachable
+func (p *Provider) Check(ctx context.Context) error {
+	_, err := p.fetchMetadata(ctx)
+	return err
+}
+
+// RandomString returns a random url-safe string, e.g. for state and nonce
+// values or PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge derives the S256 code challenge of a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL where the user authenticates with the
+// provider. The verifier has to be passed to Exchange later on.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code, returning the raw id token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {verifier},
+	}
+	if len(p.clientSecret) == 0 {
+		form.Set("client_id", p.clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(p.clientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&token)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if len(token.Error) > 0 {
+			return "", fmt.Errorf("token endpoint returned %s: %s", token.Error, token.ErrorDescription)
+		}
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	if len(token.IDToken) == 0 {
+		return "", errors.New("token endpoint returned no id token")
+	}
+
+	return token.IDToken, nil
+}
@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/oidc/oidctest"
+)
+
+// login runs the authorization code flow, returning the raw id token
+func login(t *testing.T, p *Provider, nonce string) string {
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || redirect.Query().Get("state") != "state" {
+		t.Fatalf("unexpected redirect %q (%v)", resp.Header.Get("Location"), err)
+	}
+
+	_, err = p.Exchange(context.Background(), redirect.Query().Get("code"), "wrong verifier")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("wrong code verifier was not rejected: %v", err)
+	}
+
+	// the fake provider invalidates codes after the first attempt
+	authURL, _ = p.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	resp, err = client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	redirect, _ = url.Parse(resp.Header.Get("Location"))
+
+	raw, err := p.Exchange(context.Background(), redirect.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	fake := oidctest.NewProvider("doorbell", "client secret")
+	defer fake.Close()
+
+	fake.SetUser(map[string]interface{}{
+		"sub":                "1234",
+		"preferred_username": "anna",
+		"groups":             []string{"members", "board"},
+	})
+
+	p := New(Config{
+		Issuer:       fake.URL,
+		ClientID:     "doorbell",
+		ClientSecret: "client secret",
+		RedirectURL:  "https://doorbell.example/auth/oidc/callback",
+	})
+
+	raw := login(t, p, "nonce")
+	now := time.Now()
+
+	token, err := p.Verify(context.Background(), raw, "nonce", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Subject != "1234" || token.PreferredUsername != "anna" {
+		t.Errorf("unexpected id token %+v", token)
+	}
+
+	if groups := token.Strings("groups"); len(groups) != 2 || groups[1] != "board" {
+		t.Errorf("unexpected groups %v", groups)
+	}
+
+	if _, err = p.Verify(context.Background(), raw, "other nonce", now); err == nil {
+		t.Error("id token with wrong nonce was accepted")
+	}
+
+	if _, err = p.Verify(context.Background(), raw, "nonce", now.Add(time.Hour)); err == nil {
+		t.Error("expired id token was accepted")
+	}
+
+	parts := strings.Split(raw, ".")
+	if _, err = p.Verify(context.Background(), parts[0]+"."+parts[1]+"."+parts[0], "nonce", now); err == nil {
+		t.Error("id token with invalid signature was accepted")
+	}
+
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	if _, err = p.Verify(context.Background(), unsigned, "nonce", now); err == nil {
+		t.Error("unsigned id token was accepted")
+	}
+}
+
+func TestVerifyClaimsAndKeyRotation(t *testing.T) {
+	fake := oidctest.NewProvider("doorbell", "")
+	defer fake.Close()
+
+	p := New(Config{Issuer: fake.URL + "/", ClientID: "doorbell", RedirectURL: "https://doorbell.example/"})
+
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   fake.URL,
+			"sub":   "1234",
+			"aud":   []string{"doorbell", "other"},
+			"azp":   "doorbell",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+		for name, value := range overrides {
+			c[name] = value
+		}
+		return c
+	}
+
+	if _, err := p.Verify(context.Background(), fake.IssueToken(claims(nil)), "nonce", now); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []map[string]interface{}{
+		{"iss": "https://evil.example"},
+		{"aud": "other"},
+		{"azp": "other"},
+		{"sub": ""},
+		{"iat": now.Add(time.Hour).Unix()},
+	}
+	for _, overrides := range invalid {
+		if _, err := p.Verify(context.Background(), fake.IssueToken(claims(overrides)), "nonce", now); err == nil {
+			t.Errorf("id token with %v was accepted", overrides)
+		}
+	}
+
+	// tokens of a new key are accepted once the keys may be refetched
+	fake.RotateKey()
+	rotated := fake.IssueToken(claims(nil))
+	if _, err := p.Verify(context.Background(), rotated, "nonce", now); err == nil {
+		t.Error("keys were refetched too early")
+	}
+
+	if _, err := p.Verify(context.Background(), rotated, "nonce", now.Add(minKeysRefresh)); err != nil {
+		t.Errorf("rotated key was not fetched: %s", err)
+	}
+}
@@ -0,0 +1,233 @@
+// Package oidctest provides a fake OpenID Connect provider, which approves
+// every authentication request for a configurable user.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type authorization struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]interface{}
+}
+
+// Provider is a fake OpenID Connect provider
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	key          *rsa.PrivateKey
+	keyID        int
+	claims       map[string]interface{}
+	codes        map[string]authorization
+	mutex        sync.Mutex
+}
+
+// NewProvider starts a provider for a single client
+func NewProvider(clientID, clientSecret string) *Provider {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]interface{}{"sub": "user"},
+		codes:        make(map[string]authorization),
+	}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// SetUser sets the claims of the user in subsequently issued id tokens
+func (p *Provider) SetUser(claims map[string]interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.claims = claims
+}
+
+// RotateKey replaces the signing key
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.key = key
+	p.keyID++
+}
+
+func (p *Provider) kid() string {
+	return fmt.Sprintf("key-%d", p.keyID)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	}, http.StatusOK)
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.kid(),
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	}, http.StatusOK)
+}
+
+// authorize approves the request and redirects back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID ||
+		q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		http.Error(w, "invalid authentication request", http.StatusBadRequest)
+		return
+	}
+
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+
+	p.mutex.Lock()
+	p.codes[code] = authorization{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		claims:      p.claims,
+	}
+	p.mutex.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", q.Get("state"))
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, map[string]string{"error": code, "error_description": description}, http.StatusBadRequest)
+}
+
+// token redeems a code, checking the client credentials and PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	// public clients send their id without secret
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostFormValue("client_id")
+	}
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+	if id != p.ClientID || secret != p.ClientSecret {
+		tokenError(w, "invalid_client", "client authentication failed")
+		return
+	}
+
+	p.mutex.Lock()
+	auth, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	key, kid := p.key, p.kid()
+	p.mutex.Unlock()
+
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != auth.redirectURI {
+		tokenError(w, "invalid_grant", "unknown code")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		tokenError(w, "invalid_grant", "code verifier does not match")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   auth.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": auth.nonce,
+	}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+
+	writeJSON(w, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     Sign(key, kid, claims),
+	}, http.StatusOK)
+}
+
+// Sign creates an RS256 signed token with the given claims
+func Sign(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	message := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// IssueToken returns an id token signed by the current key, bypassing the
+// authorization code flow
+func (p *Provider) IssueToken(claims map[string]interface{}) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return Sign(p.key, p.kid(), claims)
+}
@@ -0,0 +1,227 @@
+// Package pow implements a hashcash-style proof-of-work challenge. The
+// server issues signed challenges, so it does not need to keep state until
+// a solution is submitted.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid proof-of-work challenge")
+	ErrExpired          = errors.New("proof-of-work challenge has expired")
+	ErrReplayed         = errors.New("proof-of-work challenge was already solved")
+	ErrInsufficientWork = errors.New("proof-of-work solution is invalid")
+)
+
+// the window in which issued challenges count towards the load
+const loadWindow = time.Minute
+
+// maximum length of a solution
+const maxSolution = 20
+
+type Config struct {
+	// Secret signs the challenges. If empty, a random secret is used.
+	Secret []byte
+	// Difficulty is the number of leading zero bits required of the hash
+	// of a solution when idle
+	Difficulty int
+	// MaxDifficulty caps the difficulty under load
+	MaxDifficulty int
+	// TTL is how long a challenge can be solved
+	TTL time.Duration
+	// LoadStep is the number of challenges issued per minute at which the
+	// difficulty increases by one bit, and again at every doubling
+	LoadStep int
+}
+
+// Challenge is a puzzle to be solved by the client
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Expires    time.Time `json:"expires"`
+}
+
+type Pow struct {
+	secret        []byte
+	difficulty    int
+	maxDifficulty int
+	ttl           time.Duration
+	loadStep      int
+	issued        []time.Time
+	solved        map[string]time.Time
+	mutex         sync.Mutex
+}
+
+func New(c Config) *Pow {
+	if c.Difficulty <= 0 || c.Difficulty > 32 {
+		panic("proof-of-work difficulty must be between 1 and 32 bits")
+	}
+
+	if c.MaxDifficulty < c.Difficulty || c.MaxDifficulty > 32 {
+		panic("proof-of-work max difficulty must be between difficulty and 32 bits")
+	}
+
+	if c.TTL <= 0 {
+		panic("proof-of-work ttl must be positive")
+	}
+
+	if c.LoadStep <= 0 {
+		panic("proof-of-work load step must be positive")
+	}
+
+	secret := c.Secret
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return &Pow{
+		secret:        secret,
+		difficulty:    c.Difficulty,
+		maxDifficulty: c.MaxDifficulty,
+		ttl:           c.TTL,
+		loadStep:      c.LoadStep,
+		solved:        make(map[string]time.Time),
+	}
+}
+
+func (p *Pow) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// currentDifficulty records an issued challenge and returns the difficulty
+// for the current load
+func (p *Pow) currentDifficulty(now time.Time) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	recent := p.issued[:0]
+	for _, t := range p.issued {
+		if now.Sub(t) < loadWindow {
+			recent = append(recent, t)
+		}
+	}
+	p.issued = append(recent, now)
+
+	difficulty := p.difficulty + bits.Len(uint(len(recent)/p.loadStep))
+	if difficulty > p.maxDifficulty {
+		difficulty = p.maxDifficulty
+	}
+	return difficulty
+}
+
+// Issue creates a new challenge
+func (p *Pow) Issue(now time.Time) (Challenge, error) {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	difficulty := p.currentDifficulty(now)
+	expires := now.Add(p.ttl)
+
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(nonce), difficulty, expires.Unix())
+	return Challenge{
+		Challenge:  payload + "." + p.sign(payload),
+		Difficulty: difficulty,
+		Expires:    time.Unix(expires.Unix(), 0),
+	}, nil
+}
+
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+func hash(challenge, solution string) []byte {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	return sum[:]
+}
+
+// Verify checks the solution of a challenge. Every challenge can only be
+// solved once.
+func (p *Pow) Verify(challenge, solution string, now time.Time) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return ErrInvalidChallenge
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(p.sign(payload))) {
+		return ErrInvalidChallenge
+	}
+
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	expiresUnix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	expires := time.Unix(expiresUnix, 0)
+	if now.After(expires) {
+		return ErrExpired
+	}
+
+	if len(solution) == 0 || len(solution) > maxSolution {
+		return ErrInsufficientWork
+	}
+
+	if leadingZeroBits(hash(challenge, solution)) < difficulty {
+		return ErrInsufficientWork
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for nonce, exp := range p.solved {
+		if now.After(exp) {
+			delete(p.solved, nonce)
+		}
+	}
+
+	nonce := parts[0]
+	if _, ok := p.solved[nonce]; ok {
+		return ErrReplayed
+	}
+	p.solved[nonce] = expires
+
+	return nil
+}
+
+// Solve finds a solution to a challenge by brute force
+func Solve(c Challenge) string {
+	for counter := uint64(0); ; counter++ {
+		solution := strconv.FormatUint(counter, 10)
+		if leadingZeroBits(hash(c.Challenge, solution)) >= c.Difficulty {
+			return solution
+		}
+	}
+}
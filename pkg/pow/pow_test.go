@@ -0,0 +1,89 @@
+package pow
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPow() *Pow {
+	return New(Config{
+		Secret:        []byte("secret"),
+		Difficulty:    8,
+		MaxDifficulty: 10,
+		TTL:           time.Minute,
+		LoadStep:      2,
+	})
+}
+
+func TestVerify(t *testing.T) {
+	p := newPow()
+	now := time.Now()
+
+	c, err := p.Issue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solution := Solve(c)
+	if err = p.Verify(c.Challenge, solution, now); err != nil {
+		t.Errorf("valid solution was rejected: %s", err)
+	}
+
+	if err = p.Verify(c.Challenge, solution, now); err != ErrReplayed {
+		t.Errorf("expected replayed challenge to be rejected, got %v", err)
+	}
+
+	c, _ = p.Issue(now)
+	solution = Solve(c)
+
+	if err = p.Verify(c.Challenge, solution, now.Add(2*time.Minute)); err != ErrExpired {
+		t.Errorf("expected expired challenge to be rejected, got %v", err)
+	}
+
+	// lowering the difficulty invalidates the signature
+	parts := strings.Split(c.Challenge, ".")
+	parts[1] = "1"
+	if err = p.Verify(strings.Join(parts, "."), solution, now); err != ErrInvalidChallenge {
+		t.Errorf("expected tampered challenge to be rejected, got %v", err)
+	}
+
+	if err = New(Config{Secret: []byte("other"), Difficulty: 8, MaxDifficulty: 8, TTL: time.Minute, LoadStep: 1}).
+		Verify(c.Challenge, solution, now); err != ErrInvalidChallenge {
+		t.Errorf("expected challenge of other secret to be rejected, got %v", err)
+	}
+
+	c, _ = p.Issue(now)
+	for _, wrong := range []string{"", strings.Repeat("1", maxSolution+1)} {
+		if err = p.Verify(c.Challenge, wrong, now); err != ErrInsufficientWork {
+			t.Errorf("expected solution %q to be rejected, got %v", wrong, err)
+		}
+	}
+}
+
+func TestDifficultyAdjustsToLoad(t *testing.T) {
+	p := newPow()
+	now := time.Now()
+
+	var difficulties []int
+	for i := 0; i < 6; i++ {
+		c, err := p.Issue(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		difficulties = append(difficulties, c.Difficulty)
+	}
+
+	expected := []int{8, 8, 9, 9, 10, 10}
+	for i := range expected {
+		if difficulties[i] != expected[i] {
+			t.Fatalf("expected difficulties %v, got %v", expected, difficulties)
+		}
+	}
+
+	// the load decays after a minute
+	c, _ := p.Issue(now.Add(2 * time.Minute))
+	if c.Difficulty != 8 {
+		t.Errorf("difficulty did not decrease without load, got %d", c.Difficulty)
+	}
+}
@@ -1,57 +1,143 @@
 package recaptcha
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
+
+	"github.com/luxeria/doorbell/pkg/captcha"
 )
 
-type Recaptcha struct {
-	secret string
+const verifyURL = "https://www.google.com/recaptcha/api/siteverify"
+
+// Error codes of responses which were verified by Google, but do not match
+// our expectations
+const (
+	ErrorActionMismatch   = "action-mismatch"
+	ErrorHostnameMismatch = "hostname-mismatch"
+	ErrorChallengeExpired = "challenge-expired"
+)
+
+type Config struct {
+	Secret string
+	// URL of the siteverify API, defaults to the one of Google
+	URL string
+	// Client defaults to a client with a timeout of 10 seconds
+	Client *http.Client
+	// Timeout limits each attempt to verify a response
+	Timeout time.Duration
+	// Retries is the number of additional attempts after server errors or
+	// failed connections, waiting RetryBackoff before the first retry.
+	// Requests which timed out are not repeated.
+	Retries      int
+	RetryBackoff time.Duration
+	// Actions are the expected actions, any action is accepted if empty
+	Actions []string
+	// Hostnames are the sites allowed to solve the captcha, any site is
+	// accepted if empty
+	Hostnames []string
+	// MaxAge limits the age of a solved challenge, unlimited if zero
+	MaxAge time.Duration
 }
 
-type Verification struct {
-	Success     bool      `json:"success"`
-	Score       float64   `json:"score"`
-	Action      string    `json:"action"`
-	ChallengeTS time.Time `json:"challenge_ts"`
-	Hostname    string    `json:"hostname"`
-	ErrorCodes  []string  `json:"error-codes"`
+// Recaptcha verifies reCAPTCHA v3 responses
+type Recaptcha struct {
+	captcha.SiteVerify
+	actions   []string
+	hostnames []string
+	maxAge    time.Duration
 }
 
-func New(secret string) *Recaptcha {
+func New(c Config) *Recaptcha {
+	if len(c.Secret) == 0 {
+		panic("recaptcha secret must not be empty")
+	}
+
+	if c.MaxAge < 0 {
+		panic("recaptcha max age must not be negative")
+	}
+
+	if c.Retries < 0 {
+		panic("recaptcha retries must not be negative")
+	}
+
+	if len(c.URL) == 0 {
+		c.URL = verifyURL
+	}
+
 	return &Recaptcha{
-		secret: secret,
+		SiteVerify: captcha.SiteVerify{
+			URL:     c.URL,
+			Secret:  c.Secret,
+			Client:  c.Client,
+			Timeout: c.Timeout,
+			Retries: c.Retries,
+			Backoff: c.RetryBackoff,
+		},
+		actions:   c.Actions,
+		hostnames: c.Hostnames,
+		maxAge:    c.MaxAge,
 	}
 }
 
-func (r *Recaptcha) Verify(response string) (v Verification, err error) {
-	resp, err := http.PostForm("https://www.google.com/recaptcha/api/siteverify",
-		url.Values{
-			"secret":   {r.secret},
-			"response": {response},
-		})
+func (r *Recaptcha) Name() string {
+	return "reCAPTCHA"
+}
+
+func (r *Recaptcha) Verify(ctx context.Context, response, remoteIP string) (captcha.Verification, error) {
+	var res captcha.Result
+	err := r.Post(ctx, response, remoteIP, nil, &res)
 	if err != nil {
-		return v, err
+		return captcha.Verification{}, err
 	}
-	defer resp.Body.Close()
 
-	err = json.NewDecoder(resp.Body).Decode(&v)
+	v, err := res.Verification()
 	if err != nil {
 		return v, err
 	}
 
-	if len(v.ErrorCodes) > 0 {
-		return v, fmt.Errorf("siteverify returned: %s", strings.Join(v.ErrorCodes, ", "))
+	// reCAPTCHA v3 always reports a score, don't let a missing one pass
+	v.Score = 0
+	if res.Score != nil {
+		v.Score = *res.Score
 	}
 
-	if !v.Success {
-		return v, errors.New("captcha response token was invalid")
+	code, err := r.validate(v, time.Now())
+	if err != nil {
+		v.Success = false
+		v.ErrorCodes = append(v.ErrorCodes, code)
+		return v, fmt.Errorf("%s: %s", code, err)
 	}
 
 	return v, nil
-}
\ No newline at end of file
+}
+
+// validate checks a successful verification against the expected action,
+// hostname and age, returning the error code of the first mismatch
+func (r *Recaptcha) validate(v captcha.Verification, now time.Time) (string, error) {
+	if len(r.actions) > 0 && !contains(r.actions, v.Action, false) {
+		return ErrorActionMismatch, fmt.Errorf("unexpected action %q", v.Action)
+	}
+
+	if len(r.hostnames) > 0 && !contains(r.hostnames, v.Hostname, true) {
+		return ErrorHostnameMismatch, fmt.Errorf("hostname %q is not allowed", v.Hostname)
+	}
+
+	if r.maxAge > 0 && (v.ChallengeTS.IsZero() || now.Sub(v.ChallengeTS) > r.maxAge) {
+		return ErrorChallengeExpired, fmt.Errorf("challenge from %s is older than %s",
+			v.ChallengeTS.Format(time.RFC3339), r.maxAge)
+	}
+
+	return "", nil
+}
+
+func contains(list []string, s string, ignoreCase bool) bool {
+	for _, item := range list {
+		if item == s || (ignoreCase && strings.EqualFold(item, s)) {
+			return true
+		}
+	}
+	return false
+}
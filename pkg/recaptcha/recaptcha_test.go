@@ -0,0 +1,107 @@
+package recaptcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/captcha"
+	"github.com/luxeria/doorbell/pkg/captcha/captchatest"
+)
+
+func TestVerifyMismatches(t *testing.T) {
+	var reply string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, reply)
+	}))
+	defer s.Close()
+
+	r := New(Config{
+		Secret:    "secret",
+		Actions:   []string{"ring"},
+		Hostnames: []string{"doorbell.example"},
+		MaxAge:    2 * time.Minute,
+	})
+	r.URL = s.URL
+
+	now := time.Now().UTC()
+	tests := []struct {
+		action, hostname string
+		ts               time.Time
+		code             string
+	}{
+		{"ring", "doorbell.example", now, ""},
+		{"ring", "Doorbell.Example", now.Add(-time.Minute), ""},
+		{"login", "doorbell.example", now, ErrorActionMismatch},
+		{"ring", "evil.example", now, ErrorHostnameMismatch},
+		{"ring", "doorbell.example", now.Add(-5 * time.Minute), ErrorChallengeExpired},
+		{"ring", "doorbell.example", time.Time{}, ErrorChallengeExpired},
+	}
+
+	for _, tt := range tests {
+		ts := ""
+		if !tt.ts.IsZero() {
+			ts = fmt.Sprintf(`, "challenge_ts": %q`, tt.ts.Format(time.RFC3339))
+		}
+		reply = fmt.Sprintf(`{"success": true, "score": 0.9, "action": %q, "hostname": %q%s}`,
+			tt.action, tt.hostname, ts)
+
+		v, err := r.Verify(context.Background(), "token", "")
+		if len(tt.code) == 0 {
+			if err != nil || !v.Success || v.Score != 0.9 {
+				t.Errorf("%s: expected success, got %+v (%v)", reply, v, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.HasPrefix(err.Error(), tt.code+":") {
+			t.Errorf("%s: expected error %s, got %v", reply, tt.code, err)
+		}
+
+		if v.Success || len(v.ErrorCodes) != 1 || v.ErrorCodes[0] != tt.code {
+			t.Errorf("%s: unexpected verification %+v", reply, v)
+		}
+	}
+}
+
+func TestVerifyRetriesAndTimeout(t *testing.T) {
+	s := captchatest.NewServer("secret")
+	defer s.Close()
+
+	r := New(Config{
+		Secret:       "secret",
+		URL:          s.URL,
+		Timeout:      50 * time.Millisecond,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	s.Solve("token", captcha.Result{Success: true, Score: captchatest.Score(0.7)})
+	s.FailNext(2)
+
+	v, err := r.Verify(context.Background(), "token", "")
+	if err != nil || v.Score != 0.7 {
+		t.Errorf("verification did not succeed after retries: %+v (%v)", v, err)
+	}
+
+	if s.Requests() != 3 {
+		t.Errorf("expected 3 requests, got %d", s.Requests())
+	}
+
+	s.Solve("slow", captcha.Result{Success: true, Score: captchatest.Score(0.7)})
+	s.SetDelay(time.Second)
+
+	start := time.Now()
+	_, err = r.Verify(context.Background(), "slow", "")
+	if err == nil {
+		t.Error("slow verification did not time out")
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("timeout took too long: %s", elapsed)
+	}
+}
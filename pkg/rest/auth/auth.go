@@ -2,29 +2,101 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/luxeria/doorbell/pkg/captcha"
+	"github.com/luxeria/doorbell/pkg/history"
+	"github.com/luxeria/doorbell/pkg/htpasswd"
 	"github.com/luxeria/doorbell/pkg/jwt"
-	"github.com/luxeria/doorbell/pkg/recaptcha"
+	"github.com/luxeria/doorbell/pkg/metrics"
+	"github.com/luxeria/doorbell/pkg/oidc"
+	"github.com/luxeria/doorbell/pkg/pow"
 	"github.com/luxeria/doorbell/pkg/rest"
+	"github.com/luxeria/doorbell/pkg/totp"
+)
+
+var (
+	captchaScores = metrics.NewHistogramVec("doorbell_captcha_score",
+		"Scores of verified captcha responses by provider.",
+		[]float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}, "provider")
+	jwtFailures = metrics.NewCounterVec("doorbell_jwt_verification_failures_total",
+		"Requests rejected because of an invalid or expired jwt.")
+	powDifficulty = metrics.NewGauge("doorbell_pow_difficulty",
+		"Difficulty in bits of the last issued proof-of-work challenge.")
 )
 
 type Config struct {
 	JwtSecret         []byte
 	JwtExpiry         time.Duration
-	Recaptcha         *recaptcha.Recaptcha
-	RecaptchaMinScore float64
+	Captcha           captcha.Verifier
+	CaptchaMinScore   float64
+	AdminToken        []byte
+	MemberToken       []byte
+	// StepUp is presented to visitors with a captcha score between
+	// CaptchaStepUpScore and CaptchaMinScore, instead of rejecting them
+	StepUp             StepUp
+	CaptchaStepUpScore float64
+	// Pow enables authentication by proof-of-work alone, if set
+	Pow *pow.Pow
+	// DoorCodes and DoorCodeTotp are accepted by AuthCode, which is
+	// disabled if neither is set
+	DoorCodes         []string
+	DoorCodeTotp      *totp.Totp
+	DoorCodeJwtExpiry time.Duration
+	// Users can log in with AuthLogin, if set. They are members, unless
+	// they are listed in AdminUsers.
+	Users          *htpasswd.File
+	AdminUsers     []string
+	LoginJwtExpiry time.Duration
+	// OIDC enables single sign-on, if set. Users are admins or members if
+	// the OIDCGroupsClaim of their id token contains one of the respective
+	// groups. At least one member group is required, as the provider may
+	// well have users who are not supposed to open the door.
+	OIDC             *oidc.Provider
+	OIDCGroupsClaim  string
+	OIDCMemberGroups []string
+	OIDCAdminGroups  []string
+	// MaxFailedAttempts of door codes or logins lock out a client for the
+	// Lockout window. Door codes are locked for all clients after 20 times
+	// as many failures in total, logins are never locked globally.
+	MaxFailedAttempts int
+	Lockout           time.Duration
+	// History records failed captchas, if set
+	History *history.Log
 }
 
 type Auth struct {
 	jwtSecret         []byte
 	jwtExpiry         time.Duration
-	recaptcha         *recaptcha.Recaptcha
-	recaptchaMinScore float64
+	captcha           captcha.Verifier
+	captchaMinScore   float64
+	stepUpChallenge   StepUp
+	stepUpScore       float64
+	adminToken        []byte
+	memberToken       []byte
+	pow               *pow.Pow
+	doorCodes         []string
+	doorCodeTotp      *totp.Totp
+	doorCodeJwtExpiry time.Duration
+	users             *htpasswd.File
+	adminUsers        []string
+	loginJwtExpiry    time.Duration
+	oidc              *oidc.Provider
+	oidcGroupsClaim   string
+	oidcMemberGroups  []string
+	oidcAdminGroups   []string
+	codeLockout       *lockout
+	loginLockout      *lockout
+	history           *history.Log
+	captchaFailures   *throttle
 }
 
 func New(c Config) *Auth {
@@ -36,57 +108,271 @@ func New(c Config) *Auth {
 		panic("jwt expiration time must not be zero")
 	}
 
-	if c.Recaptcha == nil {
-		panic("recaptcha object must not be nil")
+	if c.Captcha == nil && c.Pow == nil {
+		panic("either captcha verifier or proof-of-work must be set")
+	}
+
+	if c.Captcha != nil && !(c.CaptchaMinScore > 0.0 && c.CaptchaMinScore < 1.0) {
+		panic("captcha min score must be between 0.0 and 1.0")
+	}
+
+	if c.StepUp != nil && c.Captcha == nil {
+		panic("step-up requires a captcha verifier")
+	}
+
+	if c.StepUp != nil && !(c.CaptchaStepUpScore >= 0.0 && c.CaptchaStepUpScore <= c.CaptchaMinScore) {
+		panic("captcha step-up score must be between 0.0 and the min score")
+	}
+
+	if (len(c.DoorCodes) > 0 || c.DoorCodeTotp != nil) && c.DoorCodeJwtExpiry <= 0 {
+		panic("door code jwt expiration time must be positive")
+	}
+
+	if (c.Users != nil || c.OIDC != nil) && c.LoginJwtExpiry <= 0 {
+		panic("login jwt expiration time must be positive")
+	}
+
+	if c.OIDC != nil && len(c.OIDCGroupsClaim) == 0 {
+		panic("oidc groups claim must not be empty")
+	}
+
+	if c.OIDC != nil && len(c.OIDCMemberGroups) == 0 {
+		panic("oidc member groups must not be empty")
 	}
 
-	if !(c.RecaptchaMinScore > 0.0 && c.RecaptchaMinScore < 1.0) {
-		panic("recaptcha min score must be between 0.0 and 1.0")
+	if (len(c.DoorCodes) > 0 || c.DoorCodeTotp != nil || c.Users != nil) &&
+		(c.MaxFailedAttempts <= 0 || c.Lockout <= 0) {
+		panic("max failed attempts and lockout must be positive")
+	}
+
+	var doorCodes []string
+	for _, code := range c.DoorCodes {
+		if code = strings.TrimSpace(code); len(code) > 0 {
+			doorCodes = append(doorCodes, code)
+		}
 	}
 
 	return &Auth{
 		jwtSecret:         c.JwtSecret,
 		jwtExpiry:         c.JwtExpiry,
-		recaptcha:         c.Recaptcha,
-		recaptchaMinScore: c.RecaptchaMinScore,
+		captcha:           c.Captcha,
+		captchaMinScore:   c.CaptchaMinScore,
+		stepUpChallenge:   c.StepUp,
+		stepUpScore:       c.CaptchaStepUpScore,
+		adminToken:        c.AdminToken,
+		memberToken:       c.MemberToken,
+		pow:               c.Pow,
+		doorCodes:         doorCodes,
+		doorCodeTotp:      c.DoorCodeTotp,
+		doorCodeJwtExpiry: c.DoorCodeJwtExpiry,
+		users:             c.Users,
+		adminUsers:        c.AdminUsers,
+		loginJwtExpiry:    c.LoginJwtExpiry,
+		oidc:              c.OIDC,
+		oidcGroupsClaim:   c.OIDCGroupsClaim,
+		oidcMemberGroups:  c.OIDCMemberGroups,
+		oidcAdminGroups:   c.OIDCAdminGroups,
+		codeLockout:       newLockout(c.MaxFailedAttempts, c.Lockout, true),
+		loginLockout:      newLockout(c.MaxFailedAttempts, c.Lockout, false),
+		captchaFailures:   newThrottle(captchaFailureInterval, captchaFailureClients),
+		history:           c.History,
 	}
 }
 
-type authRecaptchaRequest struct {
+// Roles of jwts, each granting the permissions of the previous ones.
+// Tokens without role are visitor tokens.
+const (
+	RoleVisitor = "visitor"
+	RoleMember  = "member"
+	RoleAdmin   = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleVisitor: 0,
+	RoleMember:  1,
+	RoleAdmin:   2,
+}
+
+// HasRole reports whether the claims grant the permissions of role
+func HasRole(claims jwt.Claims, role string) bool {
+	return roleLevels[claims.Role] >= roleLevels[role]
+}
+
+type authCaptchaRequest struct {
 	Response string `json:"response"`
 }
 
 type authResponse struct {
-	Token string `json:"token"`
+	Token string `json:"token,omitempty"`
+	// StepUp is set instead of the token if a fallback challenge has to be
+	// solved first
+	StepUp *stepUpResponse `json:"step_up,omitempty"`
+}
+
+// remoteIP returns the host part of the remote address of a request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
-func (a *Auth) AuthRecaptcha() http.Handler {
+func (a *Auth) AuthCaptcha() http.Handler {
 	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// decode request
-		var req authRecaptchaRequest
+		var req authCaptchaRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
 			rest.Error(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		// check and verify recaptcha score
-		v, err := a.recaptcha.Verify(req.Response)
+		if a.captcha == nil {
+			rest.Error(w, r, errors.New("captcha is disabled"), http.StatusNotFound)
+			return
+		}
+
+		// check and verify captcha score
+		v, err := a.captcha.Verify(r.Context(), req.Response, remoteIP(r))
 		if err != nil {
+			a.recordCaptchaFailure(r)
 			rest.Error(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		if v.Score < a.recaptchaMinScore {
-			rest.Error(w, r, fmt.Errorf("recaptcha score (%.2f) too low", v.Score), http.StatusUnauthorized)
+		captchaScores.With(a.captcha.Name()).Observe(v.Score)
+
+		if v.Score < a.captchaMinScore && a.stepUpChallenge != nil && v.Score >= a.stepUpScore {
+			a.stepUp(w, r)
+			return
+		}
+
+		if v.Score < a.captchaMinScore {
+			a.recordCaptchaFailure(r)
+			rest.Error(w, r, fmt.Errorf("captcha score (%.2f) too low", v.Score), http.StatusUnauthorized)
+			return
+		}
+
+		a.issueVisitorToken(w, r, a.captcha.Name())
+	}))
+}
+
+// issueVisitorToken responds with a jwt for an anonymous visitor which
+// passed the given verification
+func (a *Auth) issueVisitorToken(w http.ResponseWriter, r *http.Request, verifiedBy string) {
+	claims := jwt.Claims{
+		Subject:   fmt.Sprintf("Anonymous (%s)", verifiedBy),
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(a.jwtExpiry).Unix(),
+		Role:      RoleVisitor,
+	}
+
+	token, err := jwt.Sign(claims, a.jwtSecret)
+	if err != nil {
+		rest.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	rest.JSON(w, authResponse{Token: token}, http.StatusOK)
+}
+
+type authPowRequest struct {
+	Challenge string `json:"challenge"`
+	Solution  string `json:"solution"`
+}
+
+// AuthPow issues proof-of-work challenges on GET and exchanges solved
+// challenges for a jwt on POST
+func (a *Auth) AuthPow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.pow == nil {
+			rest.Error(w, r, errors.New("proof-of-work is disabled"), http.StatusNotFound)
 			return
 		}
 
-		// generate jwt token
+		switch r.Method {
+		case http.MethodGet:
+			c, err := a.pow.Issue(time.Now())
+			if err != nil {
+				rest.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			powDifficulty.Set(float64(c.Difficulty))
+			rest.JSON(w, c, http.StatusOK)
+		case http.MethodPost:
+			var req authPowRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				rest.Error(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			err = a.pow.Verify(req.Challenge, req.Solution, time.Now())
+			if err != nil {
+				a.recordCaptchaFailure(r)
+				rest.Error(w, r, err, http.StatusUnauthorized)
+				return
+			}
+
+			a.issueVisitorToken(w, r, "proof of work")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+const (
+	// failed challenges are recorded at most once per interval and client
+	captchaFailureInterval = time.Minute
+	// and for at most this many clients per interval
+	captchaFailureClients = 100
+)
+
+// recordCaptchaFailure records a failed challenge in the history, throttled
+// so that a flood of failures does not fill the history
+func (a *Auth) recordCaptchaFailure(r *http.Request) {
+	if a.history == nil || !a.captchaFailures.allow(remoteIP(r), time.Now()) {
+		return
+	}
+
+	err := a.history.Ring(history.Entry{
+		Time:   time.Now(),
+		IPHash: a.history.HashIP(r.RemoteAddr),
+		Result: history.ResultCaptchaFailed,
+	})
+	if err != nil {
+		log.Printf("failed to record captcha failure in history: %s", err)
+	}
+}
+
+type authMemberRequest struct {
+	Name string `json:"name"`
+}
+
+// AuthMember exchanges the member token for a jwt, to be used by clients
+// which can only authenticate with a jwt (e.g. websocket clients). Member
+// jwts are not accepted, as they would allow renewing the jwt under any name
+// long after the account was removed.
+func (a *Auth) AuthMember() http.Handler {
+	return rest.PostRequest(checkToken(RoleMember, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authMemberRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Name) == 0 {
+			req.Name = "A member"
+		}
+
 		claims := jwt.Claims{
-			Subject:   "Anonymous (reCAPTCHA)",
+			Subject:   req.Name,
 			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: time.Now().Add(a.jwtExpiry).Unix(),
+			Role:      RoleMember,
 		}
 
 		token, err := jwt.Sign(claims, a.jwtSecret)
@@ -96,23 +382,61 @@ func (a *Auth) AuthRecaptcha() http.Handler {
 		}
 
 		rest.JSON(w, authResponse{Token: token}, http.StatusOK)
-	}))
+	}), a.memberToken, a.adminToken))
 }
 
 const jwtContextKey = "jwt_claims"
 
-func (a *Auth) CheckJwt(h http.Handler) http.Handler {
+// bearerToken extracts the token from the authorization header
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+
+	var token string
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > len(prefix) && strings.EqualFold(prefix, authorization[0:len(prefix)]) {
+		token = strings.TrimSpace(authorization[len(prefix):])
+	}
+	return token
+}
+
+// QueryToken accepts the token as access_token query parameter, as browsers
+// cannot set headers on event streams and websockets. The token is moved to
+// the authorization header and removed from the URL before the request is
+// passed on, so that it does not end up in any logs.
+func QueryToken(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		const prefix = "Bearer "
+		query := r.URL.Query()
+		token, ok := query["access_token"]
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		u := *r.URL
+		query.Del("access_token")
+		u.RawQuery = query.Encode()
 
-		var token string
-		authorization := r.Header.Get("Authorization")
-		if len(authorization) > len(prefix) && strings.EqualFold(prefix, authorization[0:len(prefix)]) {
-			token = strings.TrimSpace(authorization[len(prefix):])
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = &u
+		r2.RequestURI = u.RequestURI()
+		r2.Header = make(http.Header, len(r.Header)+1)
+		for k, v := range r.Header {
+			r2.Header[k] = v
 		}
+		if len(bearerToken(r)) == 0 && len(token[0]) > 0 {
+			r2.Header.Set("Authorization", "Bearer "+token[0])
+		}
+
+		h.ServeHTTP(w, r2)
+	})
+}
 
-		claims, err := jwt.Verify(token, a.jwtSecret)
+func (a *Auth) CheckJwt(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := jwt.Verify(bearerToken(r), a.jwtSecret)
 		if err != nil {
+			jwtFailures.With().Inc()
 			rest.Error(w, r, err, http.StatusUnauthorized)
 			return
 		}
@@ -122,6 +446,75 @@ func (a *Auth) CheckJwt(h http.Handler) http.Handler {
 	})
 }
 
+// RequireRole only lets requests pass which carry a valid jwt granting the
+// permissions of role
+func (a *Auth) RequireRole(role string, h http.Handler) http.Handler {
+	return a.CheckJwt(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ExtractJwtClaims(r)
+		if !HasRole(claims, role) {
+			rest.Error(w, r, fmt.Errorf("jwt does not grant the %s role", role), http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}))
+}
+
+// matchesToken reports whether the request carries one of the given tokens,
+// ignoring empty (unconfigured) tokens
+func matchesToken(r *http.Request, tokens ...[]byte) bool {
+	token := []byte(bearerToken(r))
+	for _, t := range tokens {
+		if len(t) > 0 && subtle.ConstantTimeCompare(token, t) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkToken only lets requests pass which carry one of the static tokens
+func checkToken(role string, h http.Handler, tokens ...[]byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !matchesToken(r, tokens...) {
+			rest.Error(w, r, fmt.Errorf("invalid or missing %s token", role), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkTokenOrRole lets requests pass which carry one of the static tokens
+// or a valid jwt granting the permissions of role
+func (a *Auth) checkTokenOrRole(role string, h http.Handler, tokens ...[]byte) http.Handler {
+	withRole := a.RequireRole(role, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchesToken(r, tokens...) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if _, err := jwt.Verify(bearerToken(r), a.jwtSecret); err == nil {
+			withRole.ServeHTTP(w, r)
+			return
+		}
+
+		rest.Error(w, r, fmt.Errorf("invalid or missing %s token", role), http.StatusUnauthorized)
+	})
+}
+
+// CheckAdmin only lets requests pass which carry the configured admin token
+// or an admin jwt
+func (a *Auth) CheckAdmin(h http.Handler) http.Handler {
+	return a.checkTokenOrRole(RoleAdmin, h, a.adminToken)
+}
+
+// CheckMember only lets requests pass which carry the configured member or
+// admin token, or a member jwt
+func (a *Auth) CheckMember(h http.Handler) http.Handler {
+	return a.checkTokenOrRole(RoleMember, h, a.memberToken, a.adminToken)
+}
+
 func ExtractJwtClaims(r *http.Request) (jwt.Claims, bool) {
 	claims, ok := r.Context().Value(jwtContextKey).(jwt.Claims)
 	return claims, ok
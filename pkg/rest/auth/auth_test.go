@@ -0,0 +1,491 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/captcha"
+	"github.com/luxeria/doorbell/pkg/captcha/captchatest"
+	"github.com/luxeria/doorbell/pkg/htpasswd"
+	"github.com/luxeria/doorbell/pkg/jwt"
+	"github.com/luxeria/doorbell/pkg/oidc"
+	"github.com/luxeria/doorbell/pkg/oidc/oidctest"
+	"github.com/luxeria/doorbell/pkg/pow"
+	"github.com/luxeria/doorbell/pkg/recaptcha"
+	"github.com/luxeria/doorbell/pkg/totp"
+)
+
+func newTestAuth(siteverify *captchatest.Server) *Auth {
+	return New(Config{
+		JwtSecret: []byte("jwt secret"),
+		JwtExpiry: time.Minute,
+		Captcha: recaptcha.New(recaptcha.Config{
+			Secret:  "secret",
+			URL:     siteverify.URL,
+			Actions: []string{"ring"},
+		}),
+		CaptchaMinScore:    0.5,
+		StepUp:             PowStepUp(newTestPow()),
+		CaptchaStepUpScore: 0.2,
+		Pow:                newTestPow(),
+	})
+}
+
+func newTestPow() *pow.Pow {
+	return pow.New(pow.Config{
+		Difficulty:    4,
+		MaxDifficulty: 4,
+		TTL:           time.Minute,
+		LoadStep:      10,
+	})
+}
+
+func post(h http.Handler, target string, body interface{}) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(b)))
+	return w
+}
+
+// subject returns the subject of the jwt issued in the response, as seen by
+// a handler protected by CheckJwt
+func subject(t *testing.T, a *Auth, w *httptest.ResponseRecorder) string {
+	var resp authResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sub string
+	h := a.CheckJwt(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ExtractJwtClaims(r)
+		sub = claims.Subject
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/ring", nil)
+	r.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issued jwt was rejected: %s", rec.Body)
+	}
+
+	return sub
+}
+
+func TestAuthCaptcha(t *testing.T) {
+	s := captchatest.NewServer("secret")
+	defer s.Close()
+
+	now := time.Now()
+	s.Solve("human", captcha.Result{Success: true, Score: captchatest.Score(0.9), Action: "ring", ChallengeTS: now})
+	s.Solve("bot", captcha.Result{Success: true, Score: captchatest.Score(0.1), Action: "ring", ChallengeTS: now})
+	s.Solve("login", captcha.Result{Success: true, Score: captchatest.Score(0.9), Action: "login", ChallengeTS: now})
+
+	a := newTestAuth(s)
+	h := a.AuthCaptcha()
+
+	w := post(h, "/auth/captcha", authCaptchaRequest{Response: "human"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected token, got %d: %s", w.Code, w.Body)
+	}
+
+	if sub := subject(t, a, w); sub != "Anonymous (reCAPTCHA)" {
+		t.Errorf("unexpected subject %q", sub)
+	}
+
+	tests := []struct {
+		response string
+		code     int
+	}{
+		{"human", http.StatusBadRequest}, // replayed
+		{"bot", http.StatusUnauthorized},
+		{"login", http.StatusBadRequest},
+		{"unknown", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if w := post(h, "/auth/captcha", authCaptchaRequest{Response: tt.response}); w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d: %s", tt.response, tt.code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestQueryToken(t *testing.T) {
+	a := New(Config{
+		JwtSecret:   []byte("jwt secret"),
+		JwtExpiry:   time.Minute,
+		Pow:         newTestPow(),
+		MemberToken: []byte("member token"),
+	})
+
+	var seen *url.URL
+	h := a.CheckMember(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?access_token=member+token", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected query token to be rejected by default, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	QueryToken(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?access_token=member+token&lastEventId=3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected query token to be accepted, got %d: %s", w.Code, w.Body)
+	}
+
+	if seen.RawQuery != "lastEventId=3" {
+		t.Errorf("query token was not removed from the url: %s", seen)
+	}
+}
+
+func TestAuthPow(t *testing.T) {
+	s := captchatest.NewServer("secret")
+	defer s.Close()
+
+	a := newTestAuth(s)
+	h := a.AuthPow()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/pow", nil))
+
+	var c pow.Challenge
+	err := json.NewDecoder(w.Body).Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := authPowRequest{Challenge: c.Challenge, Solution: pow.Solve(c)}
+	w = post(h, "/auth/pow", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected token, got %d: %s", w.Code, w.Body)
+	}
+
+	if sub := subject(t, a, w); sub != "Anonymous (proof of work)" {
+		t.Errorf("unexpected subject %q", sub)
+	}
+
+	if w = post(h, "/auth/pow", req); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed solution was not rejected: %d", w.Code)
+	}
+}
+
+func TestAuthStepUp(t *testing.T) {
+	s := captchatest.NewServer("secret")
+	defer s.Close()
+
+	s.Solve("mobile", captcha.Result{Success: true, Score: captchatest.Score(0.3), Action: "ring", ChallengeTS: time.Now()})
+
+	a := newTestAuth(s)
+
+	w := post(a.AuthCaptcha(), "/auth/captcha", authCaptchaRequest{Response: "mobile"})
+	var resp struct {
+		Token  string `json:"token"`
+		StepUp struct {
+			Method    string        `json:"method"`
+			Challenge pow.Challenge `json:"challenge"`
+		} `json:"step_up"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || len(resp.Token) > 0 || resp.StepUp.Method != "pow" {
+		t.Fatalf("expected step-up, got %d: %+v", w.Code, resp)
+	}
+
+	// challenges of the standalone proof-of-work are not accepted
+	w = httptest.NewRecorder()
+	a.AuthPow().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/pow", nil))
+	var standalone pow.Challenge
+	json.NewDecoder(w.Body).Decode(&standalone)
+
+	answer, _ := json.Marshal(authPowRequest{Challenge: standalone.Challenge, Solution: pow.Solve(standalone)})
+	if w = post(a.AuthStepUp(), "/auth/stepup", authStepUpRequest{Answer: answer}); w.Code != http.StatusUnauthorized {
+		t.Errorf("standalone challenge was accepted for step-up: %d", w.Code)
+	}
+
+	c := resp.StepUp.Challenge
+	answer, _ = json.Marshal(authPowRequest{Challenge: c.Challenge, Solution: pow.Solve(c)})
+	w = post(a.AuthStepUp(), "/auth/stepup", authStepUpRequest{Answer: answer})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected token, got %d: %s", w.Code, w.Body)
+	}
+
+	if sub := subject(t, a, w); sub != "Anonymous (reCAPTCHA, pow)" {
+		t.Errorf("unexpected subject %q", sub)
+	}
+}
+
+func TestAuthCode(t *testing.T) {
+	doorCodes := totp.New(totp.Config{Secret: []byte("door code secret"), Period: 24 * time.Hour, Digits: 6})
+	a := New(Config{
+		JwtSecret:         []byte("jwt secret"),
+		JwtExpiry:         time.Minute,
+		Pow:               newTestPow(),
+		DoorCodes:         []string{"2468"},
+		DoorCodeTotp:      doorCodes,
+		DoorCodeJwtExpiry: 12 * time.Hour,
+		MaxFailedAttempts: 3,
+		Lockout:           time.Minute,
+	})
+
+	attempt := func(code, ip string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(authCodeRequest{Code: code})
+		r := httptest.NewRequest(http.MethodPost, "/auth/code", bytes.NewReader(b))
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		a.AuthCode().ServeHTTP(w, r)
+		return w
+	}
+
+	for _, code := range []string{"2468", doorCodes.Code(time.Now())} {
+		w := attempt(code, "192.0.2.1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("code %s was rejected: %s", code, w.Body)
+		}
+
+		var resp authResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		claims, err := jwt.Verify(resp.Token, []byte("jwt secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != DoorCodeSubject || claims.ExpiresAt-claims.IssuedAt != int64((12*time.Hour).Seconds()) {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := attempt("0000", "192.0.2.2"); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected invalid code to be rejected, got %d", w.Code)
+		}
+	}
+
+	if w := attempt("2468", "192.0.2.2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected client to be locked out, got %d", w.Code)
+	}
+
+	if w := attempt("2468", "192.0.2.3"); w.Code != http.StatusOK {
+		t.Errorf("other client was locked out: %d", w.Code)
+	}
+}
+
+func TestAuthLoginRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users")
+	err = ioutil.WriteFile(path, []byte(
+		"anna:$2y$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW\n"+
+			"bob:$2y$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := htpasswd.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(Config{
+		JwtSecret:         []byte("jwt secret"),
+		JwtExpiry:         time.Minute,
+		Pow:               newTestPow(),
+		AdminToken:        []byte("admin token"),
+		Users:             users,
+		AdminUsers:        []string{"bob"},
+		LoginJwtExpiry:    time.Hour,
+		MaxFailedAttempts: 3,
+		Lockout:           time.Minute,
+	})
+
+	login := func(username, password string) string {
+		w := post(a.AuthLogin(), "/auth/login", authLoginRequest{Username: username, Password: password})
+		var resp authResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Token
+	}
+
+	if token := login("anna", "wrong"); len(token) > 0 {
+		t.Error("wrong password was accepted")
+	}
+
+	anna, bob := login("anna", "U*U"), login("bob", "U*U*")
+	if len(anna) == 0 || len(bob) == 0 {
+		t.Fatal("login failed")
+	}
+
+	visitor, err := jwt.Sign(jwt.Claims{Subject: "Anonymous", ExpiresAt: time.Now().Add(time.Minute).Unix(), Role: RoleVisitor},
+		[]byte("jwt secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name    string
+		handler http.Handler
+		token   string
+		code    int
+	}{
+		{"member jwt", a.RequireRole(RoleMember, ok), anna, http.StatusOK},
+		{"visitor jwt as member", a.RequireRole(RoleMember, ok), visitor, http.StatusForbidden},
+		{"visitor jwt", a.CheckJwt(ok), visitor, http.StatusOK},
+		{"admin jwt as member", a.CheckMember(ok), bob, http.StatusOK},
+		{"member jwt as admin", a.CheckAdmin(ok), anna, http.StatusForbidden},
+		{"admin jwt", a.CheckAdmin(ok), bob, http.StatusOK},
+		{"admin token", a.CheckAdmin(ok), "admin token", http.StatusOK},
+		{"invalid token", a.CheckAdmin(ok), "invalid", http.StatusUnauthorized},
+		{"admin token for member jwt", a.AuthMember(), "admin token", http.StatusOK},
+		{"member jwt for member jwt", a.AuthMember(), anna, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	fake := oidctest.NewProvider("doorbell", "client secret")
+	defer fake.Close()
+
+	a := New(Config{
+		JwtSecret: []byte("jwt secret"),
+		JwtExpiry: time.Minute,
+		Pow:       newTestPow(),
+		OIDC: oidc.New(oidc.Config{
+			Issuer:       fake.URL,
+			ClientID:     "doorbell",
+			ClientSecret: "client secret",
+			RedirectURL:  "https://doorbell.example/auth/oidc/callback",
+		}),
+		OIDCGroupsClaim:  "groups",
+		OIDCMemberGroups: []string{"members"},
+		OIDCAdminGroups:  []string{"board"},
+		LoginJwtExpiry:   time.Hour,
+	})
+
+	// login runs the flow in a browser, which may lose the state cookie
+	login := func(keepCookie bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.OIDCLogin().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("expected redirect to provider, got %d: %s", w.Code, w.Body)
+		}
+		cookies := w.Result().Cookies()
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := client.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		if keepCookie {
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+		}
+		w = httptest.NewRecorder()
+		a.OIDCCallback().ServeHTTP(w, r)
+		return w
+	}
+
+	fake.SetUser(map[string]interface{}{"sub": "1234", "preferred_username": "anna", "groups": []string{"members", "board"}})
+	w := login(true)
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect to web ui, got %d: %s", w.Code, w.Body)
+	}
+
+	landing, _ := url.Parse(w.Header().Get("Location"))
+	fragment, _ := url.ParseQuery(landing.Fragment)
+	claims, err := jwt.Verify(fragment.Get("token"), []byte("jwt secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if landing.Path != oidcLandingPage || claims.Subject != "anna" || claims.Role != RoleAdmin {
+		t.Errorf("unexpected landing page %s with claims %+v", landing, claims)
+	}
+
+	if w = login(false); w.Code != http.StatusBadRequest {
+		t.Errorf("login without state cookie was not rejected: %d", w.Code)
+	}
+
+	fake.SetUser(map[string]interface{}{"sub": "5678", "groups": "guests"})
+	if w = login(true); w.Code != http.StatusForbidden {
+		t.Errorf("login of non-member was not rejected: %d", w.Code)
+	}
+}
+
+func TestOIDCStateCookie(t *testing.T) {
+	a := New(Config{
+		JwtSecret: []byte("jwt secret"),
+		JwtExpiry: time.Minute,
+		Pow:       newTestPow(),
+	})
+	other := New(Config{
+		JwtSecret: []byte("other secret"),
+		JwtExpiry: time.Minute,
+		Pow:       newTestPow(),
+	})
+
+	now := time.Now()
+	cookie, err := a.encodeOIDCLogin(oidcLogin{State: "state", Nonce: "nonce", Verifier: "verifier", Expires: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := a.decodeOIDCLogin(cookie, now)
+	if err != nil || login.State != "state" || login.Nonce != "nonce" || login.Verifier != "verifier" {
+		t.Errorf("unexpected login %+v: %v", login, err)
+	}
+
+	if _, err = a.decodeOIDCLogin(cookie, now.Add(2*time.Minute)); err == nil {
+		t.Error("expired login was accepted")
+	}
+
+	if _, err = other.decodeOIDCLogin(cookie, now); err == nil {
+		t.Error("login signed with another secret was accepted")
+	}
+
+	forged, _ := json.Marshal(oidcLogin{State: "state", Nonce: "forged", Verifier: "verifier", Expires: login.Expires})
+	tampered := base64.RawURLEncoding.EncodeToString(forged) + cookie[strings.Index(cookie, "."):]
+	for _, value := range []string{tampered, "state", ""} {
+		if _, err = a.decodeOIDCLogin(value, now); err == nil {
+			t.Errorf("tampered login %q was accepted", value)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/jwt"
+	"github.com/luxeria/doorbell/pkg/metrics"
+	"github.com/luxeria/doorbell/pkg/rest"
+)
+
+// DoorCodeSubject is the subject of jwts issued for door codes
+const DoorCodeSubject = "Member (door code)"
+
+var doorCodeAttempts = metrics.NewCounterVec("doorbell_door_code_attempts_total",
+	"Door code attempts by outcome (passed, failed, locked).", "outcome")
+
+func (a *Auth) doorCodeEnabled() bool {
+	return len(a.doorCodes) > 0 || a.doorCodeTotp != nil
+}
+
+func (a *Auth) validDoorCode(code string, now time.Time) bool {
+	valid := false
+	for _, c := range a.doorCodes {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(c)) == 1 {
+			valid = true
+		}
+	}
+
+	if a.doorCodeTotp != nil && a.doorCodeTotp.Validate(code, now) {
+		valid = true
+	}
+
+	return valid
+}
+
+type authCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// AuthCode exchanges a door code for a jwt, which is valid longer than the
+// ones of visitors
+func (a *Auth) AuthCode() http.Handler {
+	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.doorCodeEnabled() {
+			rest.Error(w, r, errors.New("door codes are disabled"), http.StatusNotFound)
+			return
+		}
+
+		var req authCodeRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		client := remoteIP(r)
+		if a.codeLockout.locked(client, now) {
+			doorCodeAttempts.With("locked").Inc()
+			rest.Error(w, r, errors.New("too many failed attempts, try again later"), http.StatusTooManyRequests)
+			return
+		}
+
+		if !a.validDoorCode(strings.TrimSpace(req.Code), now) {
+			a.codeLockout.fail(client, now)
+			doorCodeAttempts.With("failed").Inc()
+			rest.Error(w, r, errors.New("invalid door code"), http.StatusUnauthorized)
+			return
+		}
+
+		a.codeLockout.reset(client)
+		doorCodeAttempts.With("passed").Inc()
+
+		claims := jwt.Claims{
+			Subject:   DoorCodeSubject,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(a.doorCodeJwtExpiry).Unix(),
+			Role:      RoleVisitor,
+		}
+
+		token, err := jwt.Sign(claims, a.jwtSecret)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		rest.JSON(w, authResponse{Token: token}, http.StatusOK)
+	}))
+}
+
+type doorCodeResponse struct {
+	Code    string    `json:"code"`
+	Expires time.Time `json:"expires"`
+}
+
+// DoorCode returns the current rotating door code, to be posted inside
+func (a *Auth) DoorCode() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.doorCodeTotp == nil {
+			rest.Error(w, r, errors.New("rotating door code is disabled"), http.StatusNotFound)
+			return
+		}
+
+		now := time.Now()
+		rest.JSON(w, doorCodeResponse{
+			Code:    a.doorCodeTotp.Code(now),
+			Expires: a.doorCodeTotp.Expires(now),
+		}, http.StatusOK)
+	}))
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// lockoutGlobalFactor limits the failures of all clients combined, so a code
+// cannot be guessed by spreading attempts over many addresses
+const lockoutGlobalFactor = 20
+
+// lockout blocks clients after too many failed attempts within a window.
+// A global lockout also blocks all clients once too many attempts failed in
+// total, which lets a single client lock out everyone by rotating addresses.
+// It is therefore only meant for short codes, which could otherwise be
+// guessed.
+type lockout struct {
+	maxFailures int
+	window      time.Duration
+	global      bool
+	failures    map[string][]time.Time
+	total       []time.Time
+	mutex       sync.Mutex
+}
+
+func newLockout(maxFailures int, window time.Duration, global bool) *lockout {
+	return &lockout{
+		maxFailures: maxFailures,
+		window:      window,
+		global:      global,
+		failures:    make(map[string][]time.Time),
+	}
+}
+
+// recent drops the failures which are outside of the window
+func (l *lockout) recent(failures []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) >= l.window {
+		i++
+	}
+	return failures[i:]
+}
+
+// locked reports whether the client is currently locked out
+func (l *lockout) locked(client string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for c, failures := range l.failures {
+		if failures = l.recent(failures, now); len(failures) > 0 {
+			l.failures[c] = failures
+		} else {
+			delete(l.failures, c)
+		}
+	}
+	l.total = l.recent(l.total, now)
+
+	return len(l.failures[client]) >= l.maxFailures ||
+		l.global && len(l.total) >= l.maxFailures*lockoutGlobalFactor
+}
+
+func (l *lockout) fail(client string, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.failures[client] = append(l.failures[client], now)
+	l.total = append(l.total, now)
+}
+
+func (l *lockout) reset(client string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.failures, client)
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	l := newLockout(2, time.Minute, true)
+	now := time.Now()
+
+	l.fail("a", now)
+	if l.locked("a", now) {
+		t.Error("client locked out before reaching max failures")
+	}
+
+	l.fail("a", now.Add(time.Second))
+	if !l.locked("a", now.Add(time.Second)) {
+		t.Error("client not locked out after max failures")
+	}
+
+	if l.locked("a", now.Add(time.Minute+time.Second)) {
+		t.Error("client still locked out after window")
+	}
+
+	l.fail("b", now)
+	l.reset("b")
+	l.fail("b", now)
+	if l.locked("b", now) {
+		t.Error("failures were not reset")
+	}
+
+	// spreading attempts over many clients locks out everyone
+	for i := 0; i < 2*lockoutGlobalFactor; i++ {
+		l.fail(fmt.Sprintf("client %d", i), now)
+	}
+	if !l.locked("c", now) {
+		t.Error("global lockout did not apply")
+	}
+
+	l = newLockout(2, time.Minute, false)
+	for i := 0; i < 2*lockoutGlobalFactor; i++ {
+		l.fail(fmt.Sprintf("client %d", i), now)
+	}
+	if l.locked("c", now) {
+		t.Error("global lockout applied to per-client lockout")
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/jwt"
+	"github.com/luxeria/doorbell/pkg/rest"
+)
+
+type authLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// userRole returns the role granted to a user of the password file
+func (a *Auth) userRole(username string) string {
+	for _, admin := range a.adminUsers {
+		if admin == username {
+			return RoleAdmin
+		}
+	}
+	return RoleMember
+}
+
+// AuthLogin exchanges the username and password of a member for a jwt,
+// with the username as subject
+func (a *Auth) AuthLogin() http.Handler {
+	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.users == nil {
+			rest.Error(w, r, errors.New("login is disabled"), http.StatusNotFound)
+			return
+		}
+
+		var req authLoginRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		client := remoteIP(r)
+		if a.loginLockout.locked(client, now) {
+			rest.Error(w, r, errors.New("too many failed attempts, try again later"), http.StatusTooManyRequests)
+			return
+		}
+
+		err = a.users.Authenticate(req.Username, req.Password)
+		if err != nil {
+			a.loginLockout.fail(client, now)
+			rest.Error(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		a.loginLockout.reset(client)
+
+		claims := jwt.Claims{
+			Subject:   req.Username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(a.loginJwtExpiry).Unix(),
+			Role:      a.userRole(req.Username),
+		}
+
+		token, err := jwt.Sign(claims, a.jwtSecret)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		rest.JSON(w, authResponse{Token: token}, http.StatusOK)
+	}))
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/jwt"
+	"github.com/luxeria/doorbell/pkg/oidc"
+	"github.com/luxeria/doorbell/pkg/rest"
+)
+
+const (
+	// oidcStateCookie carries the login in progress, binding the callback to
+	// the browser which started the login to prevent login CSRF
+	oidcStateCookie = "doorbell_oidc_state"
+	// oidcLoginTimeout limits how long users can take to log in
+	oidcLoginTimeout = 10 * time.Minute
+	// oidcLandingPage receives the issued jwt in the URL fragment
+	oidcLandingPage = "/webui/"
+)
+
+var errOIDCState = errors.New("login was not started by this browser")
+
+// oidcLogin is a login in progress. It is kept in the signed state cookie
+// rather than on the server, so anonymous clients cannot exhaust any
+// server-side storage by starting logins.
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Expires  int64  `json:"exp"`
+}
+
+// oidcCookieMAC signs the state cookie with a key derived from the jwt
+// secret, so that cookies and jwts cannot be swapped for one another
+func (a *Auth) oidcCookieMAC(payload string) []byte {
+	key := hmac.New(sha256.New, a.jwtSecret)
+	key.Write([]byte("oidc state cookie"))
+
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (a *Auth) encodeOIDCLogin(login oidcLogin) (string, error) {
+	b, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.oidcCookieMAC(payload)), nil
+}
+
+func (a *Auth) decodeOIDCLogin(cookie string, now time.Time) (oidcLogin, error) {
+	parts := strings.SplitN(cookie, ".", 2)
+	if len(parts) != 2 {
+		return oidcLogin{}, errOIDCState
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, a.oidcCookieMAC(parts[0])) {
+		return oidcLogin{}, errOIDCState
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return oidcLogin{}, errOIDCState
+	}
+
+	var login oidcLogin
+	err = json.Unmarshal(b, &login)
+	if err != nil {
+		return oidcLogin{}, errOIDCState
+	}
+
+	if now.Unix() > login.Expires {
+		return oidcLogin{}, errors.New("login has expired, please try again")
+	}
+
+	return login, nil
+}
+
+// oidcRole maps the groups of the user to a role, which is empty for users
+// in none of the configured groups
+func (a *Auth) oidcRole(token *oidc.IDToken) string {
+	groups := token.Strings(a.oidcGroupsClaim)
+
+	contains := func(list []string, group string) bool {
+		for _, item := range list {
+			if item == group {
+				return true
+			}
+		}
+		return false
+	}
+
+	role := ""
+	for _, group := range groups {
+		if contains(a.oidcAdminGroups, group) {
+			return RoleAdmin
+		}
+
+		if contains(a.oidcMemberGroups, group) {
+			role = RoleMember
+		}
+	}
+
+	return role
+}
+
+// OIDCLogin redirects to the OpenID Connect provider
+func (a *Auth) OIDCLogin() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.oidc == nil {
+			rest.Error(w, r, errors.New("single sign-on is disabled"), http.StatusNotFound)
+			return
+		}
+
+		var values [3]string
+		for i := range values {
+			v, err := oidc.RandomString()
+			if err != nil {
+				rest.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			values[i] = v
+		}
+		login := oidcLogin{
+			State:    values[0],
+			Nonce:    values[1],
+			Verifier: values[2],
+			Expires:  time.Now().Add(oidcLoginTimeout).Unix(),
+		}
+
+		cookie, err := a.encodeOIDCLogin(login)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		authURL, err := a.oidc.AuthCodeURL(r.Context(), login.State, login.Nonce, login.Verifier)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadGateway)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    cookie,
+			Path:     "/auth/oidc/",
+			MaxAge:   int(oidcLoginTimeout / time.Second),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}))
+}
+
+// OIDCCallback receives the authorization code from the provider and
+// passes the issued jwt to the web UI
+func (a *Auth) OIDCCallback() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.oidc == nil {
+			rest.Error(w, r, errors.New("single sign-on is disabled"), http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		if e := query.Get("error"); len(e) > 0 {
+			rest.Error(w, r, errors.New("login failed: "+e+" "+query.Get("error_description")), http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc/", MaxAge: -1})
+
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			rest.Error(w, r, errOIDCState, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		login, err := a.decodeOIDCLogin(cookie.Value, now)
+		if err == nil && query.Get("state") != login.State {
+			err = errOIDCState
+		}
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		raw, err := a.oidc.Exchange(r.Context(), query.Get("code"), login.Verifier)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadGateway)
+			return
+		}
+
+		token, err := a.oidc.Verify(r.Context(), raw, login.Nonce, now)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		role := a.oidcRole(token)
+		if len(role) == 0 {
+			rest.Error(w, r, errors.New("not a member of an authorized group"), http.StatusForbidden)
+			return
+		}
+
+		subject := token.PreferredUsername
+		if len(subject) == 0 {
+			subject = token.Name
+		}
+		if len(subject) == 0 {
+			subject = token.Subject
+		}
+
+		claims := jwt.Claims{
+			Subject:   subject,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(a.loginJwtExpiry).Unix(),
+			Role:      role,
+		}
+
+		signed, err := jwt.Sign(claims, a.jwtSecret)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the fragment is not sent to servers and kept out of logs
+		fragment := url.Values{"token": {signed}}
+		http.Redirect(w, r, oidcLandingPage+"#"+fragment.Encode(), http.StatusFound)
+	}))
+}
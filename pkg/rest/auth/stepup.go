@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/metrics"
+	"github.com/luxeria/doorbell/pkg/pow"
+	"github.com/luxeria/doorbell/pkg/rest"
+)
+
+var stepUps = metrics.NewCounterVec("doorbell_captcha_step_ups_total",
+	"Fallback challenges by method and outcome (issued, passed, failed).", "method", "outcome")
+
+// StepUp is an interactive fallback challenge for visitors whose captcha
+// score is too low for a token, but too high to be rejected outright
+type StepUp interface {
+	// Method tells the web UI which challenge to present
+	Method() string
+	// Challenge returns what the web UI needs to present the challenge
+	Challenge() (interface{}, error)
+	// Verify checks the answer of the visitor
+	Verify(answer json.RawMessage) error
+}
+
+type powStepUp struct {
+	pow *pow.Pow
+}
+
+// PowStepUp asks visitors to solve a proof-of-work challenge. The challenges
+// must not be obtainable otherwise, so p must not be used for anything else.
+func PowStepUp(p *pow.Pow) StepUp {
+	return &powStepUp{pow: p}
+}
+
+func (s *powStepUp) Method() string {
+	return "pow"
+}
+
+func (s *powStepUp) Challenge() (interface{}, error) {
+	return s.pow.Issue(time.Now())
+}
+
+func (s *powStepUp) Verify(answer json.RawMessage) error {
+	var req authPowRequest
+	err := json.Unmarshal(answer, &req)
+	if err != nil {
+		return err
+	}
+
+	return s.pow.Verify(req.Challenge, req.Solution, time.Now())
+}
+
+type stepUpResponse struct {
+	Method    string      `json:"method"`
+	Challenge interface{} `json:"challenge"`
+}
+
+// stepUp responds with a fallback challenge instead of a token
+func (a *Auth) stepUp(w http.ResponseWriter, r *http.Request) {
+	challenge, err := a.stepUpChallenge.Challenge()
+	if err != nil {
+		rest.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	stepUps.With(a.stepUpChallenge.Method(), "issued").Inc()
+	rest.JSON(w, authResponse{StepUp: &stepUpResponse{
+		Method:    a.stepUpChallenge.Method(),
+		Challenge: challenge,
+	}}, http.StatusOK)
+}
+
+type authStepUpRequest struct {
+	Answer json.RawMessage `json:"answer"`
+}
+
+// AuthStepUp exchanges the answer to a fallback challenge for a jwt
+func (a *Auth) AuthStepUp() http.Handler {
+	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.stepUpChallenge == nil {
+			rest.Error(w, r, errors.New("step-up is disabled"), http.StatusNotFound)
+			return
+		}
+
+		var req authStepUpRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		method := a.stepUpChallenge.Method()
+		err = a.stepUpChallenge.Verify(req.Answer)
+		if err != nil {
+			stepUps.With(method, "failed").Inc()
+			a.recordCaptchaFailure(r)
+			rest.Error(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		stepUps.With(method, "passed").Inc()
+		a.issueVisitorToken(w, r, fmt.Sprintf("%s, %s", a.captcha.Name(), method))
+	}))
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle allows an action at most once per interval and client, and for
+// at most maxClients clients per interval combined
+type throttle struct {
+	interval   time.Duration
+	maxClients int
+	last       map[string]time.Time
+	mutex      sync.Mutex
+}
+
+func newThrottle(interval time.Duration, maxClients int) *throttle {
+	return &throttle{
+		interval:   interval,
+		maxClients: maxClients,
+		last:       make(map[string]time.Time),
+	}
+}
+
+// allow reports whether the client may act at the given time, counting the
+// action if so
+func (t *throttle) allow(client string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for c, last := range t.last {
+		if now.Sub(last) >= t.interval {
+			delete(t.last, c)
+		}
+	}
+
+	if _, ok := t.last[client]; ok || len(t.last) >= t.maxClients {
+		return false
+	}
+
+	t.last[client] = now
+	return true
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(time.Minute, 2)
+	now := time.Now()
+
+	if !th.allow("a", now) || th.allow("a", now.Add(time.Second)) {
+		t.Error("client was not throttled within interval")
+	}
+
+	if !th.allow("b", now) || th.allow("c", now) {
+		t.Error("clients were not throttled in total")
+	}
+
+	if !th.allow("a", now.Add(time.Minute)) || !th.allow("c", now.Add(time.Minute)) {
+		t.Error("clients still throttled after interval")
+	}
+}
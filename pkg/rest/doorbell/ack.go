@@ -0,0 +1,265 @@
+package doorbell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/luxeria/doorbell/pkg/rest"
+	"github.com/luxeria/doorbell/pkg/rest/auth"
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+const (
+	// how long a status request waits for an acknowledgement
+	statusPollTimeout = 30 * time.Second
+	// how long expired rings are kept around to report their status
+	ringRetention = time.Hour
+	// maximum length of a message for whoever is ringing
+	maxAckMessage = 280
+	// maximum number of replies to a single ring
+	maxReplies = 20
+)
+
+var (
+	errUnknownRing = errors.New("unknown ring")
+	errExpiredRing = errors.New("ring has expired")
+)
+
+type ring struct {
+	event   ringer.Event
+	expires time.Time
+	// replies in the order they were received, the first one acknowledges
+	// the ring
+	replies []ringer.Ack
+	// closed and replaced whenever a reply is received
+	replied chan struct{}
+}
+
+func (d *Doorbell) register(e ringer.Event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for id, r := range d.rings {
+		if time.Since(r.expires) > ringRetention {
+			delete(d.rings, id)
+		}
+	}
+
+	d.rings[e.ID] = &ring{
+		event:   e,
+		expires: e.Time.Add(d.ackTimeout),
+		replied: make(chan struct{}),
+	}
+}
+
+func (d *Doorbell) lookup(id string) (*ring, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	r, ok := d.rings[id]
+	return r, ok
+}
+
+// Acknowledge records a reply to a ring. The first reply acknowledges the
+// ring and is forwarded to the ringers, later replies (e.g. a message after
+// asking to wait) are only passed on to the visitor.
+func (d *Doorbell) Acknowledge(id string, a ringer.Ack) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+
+	d.mutex.Lock()
+	r, ok := d.rings[id]
+	if !ok {
+		d.mutex.Unlock()
+		return errUnknownRing
+	}
+
+	first := len(r.replies) == 0
+	if first && a.Time.After(r.expires) {
+		d.mutex.Unlock()
+		return errExpiredRing
+	}
+
+	if len(r.replies) >= maxReplies {
+		d.mutex.Unlock()
+		return fmt.Errorf("ring must not have more than %d replies", maxReplies)
+	}
+
+	r.replies = append(r.replies, a)
+	close(r.replied)
+	r.replied = make(chan struct{})
+	e := r.event
+	d.mutex.Unlock()
+
+	d.publish(EventAck, ackEvent{ID: id, Ack: a})
+	if !first {
+		log.Printf("%q replied to ring %s (%s)", a.By, id, a.Reply)
+		return nil
+	}
+
+	log.Printf("%q acknowledged ring %s (%s)", a.By, id, a.Reply)
+	d.recordAck(id, a)
+
+	if acknowledger, ok := d.ringer.(ringer.Acknowledger); ok {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), d.ringTimeout)
+			defer cancel()
+
+			err := acknowledger.Acknowledge(ctx, e, a)
+			if err != nil {
+				log.Printf("forwarding acknowledgement failed: %s", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// newAck validates a reply to a ring
+func newAck(by, reply, message string) (ringer.Ack, error) {
+	switch reply {
+	case ringer.ReplyComing, ringer.ReplyWait, ringer.ReplyNobody:
+	default:
+		return ringer.Ack{}, fmt.Errorf("invalid reply %q", reply)
+	}
+
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > maxAckMessage {
+		return ringer.Ack{}, fmt.Errorf("message must not exceed %d characters", maxAckMessage)
+	}
+
+	if len(by) == 0 {
+		by = "A member"
+	}
+
+	return ringer.Ack{
+		By:      by,
+		Reply:   reply,
+		Time:    time.Now(),
+		Message: message,
+	}, nil
+}
+
+type ackRequest struct {
+	ID      string `json:"id"`
+	By      string `json:"by"`
+	Reply   string `json:"reply"`
+	Message string `json:"message"`
+}
+
+// AcknowledgeRing lets members acknowledge a ring
+func (d *Doorbell) AcknowledgeRing() http.Handler {
+	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ackRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// members with an account reply under their own name, the name in
+		// the request is only used for the static member tokens
+		by := req.By
+		if c, ok := auth.ExtractJwtClaims(r); ok && len(c.Subject) > 0 {
+			by = c.Subject
+		}
+
+		a, err := newAck(by, req.Reply, req.Message)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		err = d.Acknowledge(req.ID, a)
+		switch {
+		case err == errUnknownRing:
+			rest.Error(w, r, err, http.StatusNotFound)
+		case err != nil:
+			rest.Error(w, r, err, http.StatusConflict)
+		default:
+			rest.JSON(w, a, http.StatusOK)
+		}
+	}))
+}
+
+const (
+	statusPending      = "pending"
+	statusAcknowledged = "acknowledged"
+	statusExpired      = "expired"
+)
+
+// statusResponse carries all replies to a ring, Ack being the latest one
+type statusResponse struct {
+	ID      string       `json:"id"`
+	Status  string       `json:"status"`
+	Expires time.Time    `json:"expires"`
+	Ack     *ringer.Ack  `json:"ack,omitempty"`
+	Replies []ringer.Ack `json:"replies,omitempty"`
+}
+
+// Status reports whether a ring has been acknowledged or has expired. While
+// neither is the case, or no more replies than given by the replies
+// parameter have been received, the request is held open until that changes
+// or the poll timeout is reached.
+func (d *Doorbell) Status() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		rg, ok := d.lookup(id)
+		if !ok {
+			rest.Error(w, r, errUnknownRing, http.StatusNotFound)
+			return
+		}
+
+		seen, _ := strconv.Atoi(r.URL.Query().Get("replies"))
+
+		d.mutex.Lock()
+		replied := rg.replied
+		received := len(rg.replies)
+		d.mutex.Unlock()
+
+		if received <= seen {
+			// acknowledged rings no longer expire
+			wait := statusPollTimeout
+			if received == 0 && time.Until(rg.expires) < wait {
+				wait = time.Until(rg.expires)
+			}
+
+			timeout := time.NewTimer(wait)
+			defer timeout.Stop()
+
+			select {
+			case <-replied:
+			case <-timeout.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		d.mutex.Lock()
+		resp := statusResponse{
+			ID:      id,
+			Status:  statusPending,
+			Expires: rg.expires,
+		}
+		if n := len(rg.replies); n > 0 {
+			latest := rg.replies[n-1]
+			resp.Status = statusAcknowledged
+			resp.Ack = &latest
+			resp.Replies = append([]ringer.Ack(nil), rg.replies...)
+		} else if !time.Now().Before(rg.expires) {
+			resp.Status = statusExpired
+		}
+		d.mutex.Unlock()
+
+		rest.JSON(w, resp, http.StatusOK)
+	}))
+}
@@ -0,0 +1,233 @@
+package doorbell
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/jwt"
+	"github.com/luxeria/doorbell/pkg/openinghours"
+	"github.com/luxeria/doorbell/pkg/pow"
+	"github.com/luxeria/doorbell/pkg/ratelimit"
+	"github.com/luxeria/doorbell/pkg/rest/auth"
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+type silentRinger struct{}
+
+func (silentRinger) Ring(ctx context.Context, e ringer.Event) error {
+	return nil
+}
+
+func newTestDoorbell(t *testing.T, ackTimeout time.Duration) *Doorbell {
+	hours, err := openinghours.Parse("Mo-Su 00:00-23:59")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(Config{
+		OpeningHours: hours,
+		RateLimit:    ratelimit.TokenBucket(100, time.Millisecond),
+		Ringer:       silentRinger{},
+		RingTimeout:  time.Second,
+		AckTimeout:   ackTimeout,
+	})
+
+	// keep the doorbell open regardless of when the test runs
+	d.mutex.Lock()
+	d.override = &Override{Open: true, Until: time.Now().Add(time.Hour)}
+	d.mutex.Unlock()
+	return d
+}
+
+func ringTestDoorbell(t *testing.T, d *Doorbell) string {
+	w := httptest.NewRecorder()
+	d.Ring().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ring", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ring failed with %d: %s", w.Code, w.Body)
+	}
+
+	var resp ringResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.ID
+}
+
+func acknowledge(h http.Handler, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/ring/ack", strings.NewReader(body))
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func status(t *testing.T, d *Doorbell, id string) (int, statusResponse) {
+	w := httptest.NewRecorder()
+	d.Status().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ring/status?id="+id, nil))
+
+	var resp statusResponse
+	if w.Code == http.StatusOK {
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestAcknowledgeRing(t *testing.T) {
+	d := newTestDoorbell(t, time.Minute)
+	id := ringTestDoorbell(t, d)
+
+	// the status request is held open until the ring is acknowledged
+	polled := make(chan statusResponse)
+	go func() {
+		_, resp := status(t, d, id)
+		polled <- resp
+	}()
+
+	for body, code := range map[string]int{
+		`{"id": "unknown", "reply": "coming"}`:   http.StatusNotFound,
+		`{"id": "` + id + `", "reply": "maybe"}`: http.StatusBadRequest,
+		`{"id": "` + id + `", "reply": "coming", "message": "` + strings.Repeat("a", maxAckMessage+1) + `"}`: http.StatusBadRequest,
+	} {
+		if w := acknowledge(d.AcknowledgeRing(), body, ""); w.Code != code {
+			t.Errorf("expected %d for %s, got %d", code, body, w.Code)
+		}
+	}
+
+	w := acknowledge(d.AcknowledgeRing(), `{"id": "`+id+`", "by": "Anna", "reply": "coming"}`, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("acknowledgement failed with %d: %s", w.Code, w.Body)
+	}
+
+	select {
+	case resp := <-polled:
+		if resp.Status != statusAcknowledged || resp.Ack == nil || resp.Ack.By != "Anna" || resp.Ack.Reply != ringer.ReplyComing {
+			t.Errorf("unexpected status: %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("status poll did not return after acknowledgement")
+	}
+
+	// later replies are streamed to the visitor as well
+	go func() {
+		_, resp := status(t, d, id+"&replies=1")
+		polled <- resp
+	}()
+
+	w = acknowledge(d.AcknowledgeRing(), `{"id": "`+id+`", "by": "Anna", "reply": "wait", "message": "Almost there"}`, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("follow-up reply failed with %d: %s", w.Code, w.Body)
+	}
+
+	select {
+	case resp := <-polled:
+		if resp.Status != statusAcknowledged || len(resp.Replies) != 2 || resp.Ack == nil || resp.Ack.Message != "Almost there" {
+			t.Errorf("unexpected status: %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("status poll did not return after follow-up reply")
+	}
+
+	for i := 2; i < maxReplies; i++ {
+		acknowledge(d.AcknowledgeRing(), `{"id": "`+id+`", "reply": "wait"}`, "")
+	}
+
+	w = acknowledge(d.AcknowledgeRing(), `{"id": "`+id+`", "reply": "nobody"}`, "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected reply beyond the limit to conflict, got %d", w.Code)
+	}
+}
+
+func TestRingExpires(t *testing.T) {
+	d := newTestDoorbell(t, 50*time.Millisecond)
+	id := ringTestDoorbell(t, d)
+
+	code, resp := status(t, d, id)
+	if code != http.StatusOK || resp.Status != statusExpired || resp.Ack != nil {
+		t.Errorf("expected ring to expire, got %d: %+v", code, resp)
+	}
+
+	w := acknowledge(d.AcknowledgeRing(), `{"id": "`+id+`", "reply": "coming"}`, "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected acknowledgement of expired ring to conflict, got %d", w.Code)
+	}
+
+	if code, _ := status(t, d, "unknown"); code != http.StatusNotFound {
+		t.Errorf("expected status of unknown ring to be 404, got %d", code)
+	}
+}
+
+func TestAcknowledgeRingAuthorization(t *testing.T) {
+	secret := []byte("jwt secret")
+	a := auth.New(auth.Config{
+		JwtSecret:   secret,
+		JwtExpiry:   time.Minute,
+		MemberToken: []byte("member token"),
+		Pow: pow.New(pow.Config{
+			Difficulty:    4,
+			MaxDifficulty: 4,
+			TTL:           time.Minute,
+			LoadStep:      10,
+		}),
+	})
+
+	sign := func(role string) string {
+		token, err := jwt.Sign(jwt.Claims{
+			Subject:   "Anna",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			Role:      role,
+		}, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	d := newTestDoorbell(t, time.Minute)
+	h := a.CheckMember(d.AcknowledgeRing())
+
+	for token, code := range map[string]int{
+		"":                     http.StatusUnauthorized,
+		"wrong token":          http.StatusUnauthorized,
+		sign(auth.RoleVisitor): http.StatusForbidden,
+		"member token":         http.StatusOK,
+		sign(auth.RoleMember):  http.StatusOK,
+		sign(auth.RoleAdmin):   http.StatusOK,
+	} {
+		id := ringTestDoorbell(t, d)
+		w := acknowledge(h, `{"id": "`+id+`", "reply": "coming"}`, token)
+		if w.Code != code {
+			t.Errorf("expected %d for token %q, got %d", code, token, w.Code)
+		}
+	}
+
+	// the name is taken from the jwt, it is only up to static token holders
+	for token, by := range map[string]string{
+		"member token":        "Bob",
+		sign(auth.RoleMember): "Anna",
+	} {
+		id := ringTestDoorbell(t, d)
+		w := acknowledge(h, `{"id": "`+id+`", "by": "Bob", "reply": "coming"}`, token)
+
+		var a ringer.Ack
+		err := json.NewDecoder(w.Body).Decode(&a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a.By != by {
+			t.Errorf("expected acknowledgement by %q, got %q", by, a.By)
+		}
+	}
+}
@@ -1,28 +1,51 @@
 package doorbell
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/luxeria/doorbell/pkg/rest/auth"
 	"log"
 	"net/http"
-	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/luxeria/doorbell/pkg/history"
 	"github.com/luxeria/doorbell/pkg/openinghours"
 	"github.com/luxeria/doorbell/pkg/ratelimit"
 	"github.com/luxeria/doorbell/pkg/rest"
+	"github.com/luxeria/doorbell/pkg/ringer"
 )
 
 type Config struct {
 	OpeningHours openinghours.OpeningHours
 	RateLimit    *ratelimit.Bucket
-	DoorbellCmd  []string
+	Ringer       ringer.Ringer
+	// RingTimeout limits how long the ringer may take for a ring or an
+	// acknowledgement, so that hung ringers do not pile up
+	RingTimeout time.Duration
+	// AckTimeout limits how long rings can be acknowledged
+	AckTimeout time.Duration
+	// BlockedWords are rejected in names and messages left by visitors
+	BlockedWords []string
+	// History records all rings, if set
+	History *history.Log
 }
 
 type Doorbell struct {
 	openingHours openinghours.OpeningHours
 	rateLimit    *ratelimit.Bucket
-	doorbellCmd  []string
+	ringer       ringer.Ringer
+	ringTimeout  time.Duration
+	ackTimeout   time.Duration
+	blockedWords []string
+	history      *history.Log
+	rings        map[string]*ring
+	override     *Override
+	hub          *Hub
+	mutex        sync.Mutex
 }
 
 func New(c Config) *Doorbell {
@@ -34,55 +57,145 @@ func New(c Config) *Doorbell {
 		panic("ratelimit bucket is nil")
 	}
 
-	if len(c.DoorbellCmd) == 0 {
-		panic("doorbell command is empty")
+	if c.Ringer == nil {
+		panic("doorbell ringer is nil")
 	}
 
-	return &Doorbell{
+	if c.RingTimeout <= 0 {
+		panic("ring timeout must be positive")
+	}
+
+	if c.AckTimeout <= 0 {
+		panic("acknowledgement timeout must be positive")
+	}
+
+	var blockedWords []string
+	for _, word := range c.BlockedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); len(word) > 0 {
+			blockedWords = append(blockedWords, word)
+		}
+	}
+
+	d := &Doorbell{
 		openingHours: c.OpeningHours,
 		rateLimit:    c.RateLimit,
-		doorbellCmd:  c.DoorbellCmd,
+		ringer:       c.Ringer,
+		ringTimeout:  c.RingTimeout,
+		ackTimeout:   c.AckTimeout,
+		blockedWords: blockedWords,
+		history:      c.History,
+		rings:        make(map[string]*ring),
+		hub:          NewHub(eventHistory, eventBuffer),
+	}
+
+	go d.watchSchedule()
+
+	if listener, ok := d.ringer.(ringer.Listener); ok {
+		go listener.Listen(context.Background(), d.Acknowledge)
+	}
+
+	return d
+}
+
+func newRingID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(id), nil
+}
+
+type ringResponse struct {
+	ID string `json:"id"`
 }
 
 func (d *Doorbell) Ring() http.Handler {
 	return rest.PostRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !d.openingHours.IsOpen() {
+		open, overridden := d.isOpen(time.Now())
+		if !open {
+			d.recordRing(r, ringer.Event{}, history.ResultClosed)
+			ringsTotal.With(reasonClosed).Inc()
 			rest.Error(w, r, errors.New("unavailable outside opening hours"), http.StatusServiceUnavailable)
 			return
 		}
 
+		// invalid requests must not use up the rate limit
+		req, err := d.decodeRingRequest(w, r)
+		if err != nil {
+			rest.Error(w, r, err, http.StatusBadRequest)
+			return
+		}
+
 		if !d.rateLimit.Take() {
+			d.recordRing(r, ringer.Event{}, history.ResultRateLimited)
+			ringsTotal.With(reasonRateLimited).Inc()
 			rest.Error(w, r, errors.New("rate limit occurred"), http.StatusTooManyRequests)
 			return
 		}
 
-		cmd := exec.Command(d.doorbellCmd[0], d.doorbellCmd[1:]...)
-		err := cmd.Start()
+		id, err := newRingID()
 		if err != nil {
 			rest.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
+		e := ringer.Event{
+			ID:       id,
+			Time:     time.Now(),
+			Name:     req.Name,
+			Message:  req.Message,
+			Override: overridden,
+		}
+
 		if c, ok := auth.ExtractJwtClaims(r); ok {
+			e.Subject = c.Subject
+			// members are announced by their account name
+			if len(e.Name) == 0 && auth.HasRole(c, auth.RoleMember) {
+				e.Name = c.Subject
+			}
 			log.Printf("%q is ringing doorbell!", c.Subject)
 		} else {
 			log.Println("unknown user is ringing doorbell!")
 		}
 
-		// wait for completion in background
+		d.register(e)
+		d.recordRing(r, e, history.ResultPending)
+		d.publish(EventRing, e)
+
+		// ring in background, the request context ends with the response
 		go func() {
-			err := cmd.Wait()
+			ctx, cancel := context.WithTimeout(context.Background(), d.ringTimeout)
+			defer cancel()
+
+			err := d.ringer.Ring(ctx, e)
+			d.recordResult(e.ID, err)
 			if err != nil {
-				args := strings.Join(d.doorbellCmd, " ")
-				if exitErr, ok := err.(*exec.ExitError); ok {
-					log.Printf("command `%s` failed (%s): %s", args, exitErr, exitErr.Stderr)
-				} else {
-					log.Printf("command `%s` failed with error: %s", args, err)
-				}
+				ringsTotal.With(reasonExecError).Inc()
+				log.Printf("ringing doorbell failed: %s", err)
+			} else {
+				ringsTotal.With(reasonOK).Inc()
 			}
 		}()
 
-		rest.JSON(w, "RING", http.StatusOK)
+		rest.JSON(w, ringResponse{ID: e.ID}, http.StatusOK)
 	}))
-}
\ No newline at end of file
+}
+
+type diagnosticsResponse struct {
+	Results []ringer.Result `json:"results"`
+}
+
+func (d *Doorbell) Diagnostics() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := diagnosticsResponse{
+			Results: []ringer.Result{},
+		}
+
+		if reporter, ok := d.ringer.(ringer.Reporter); ok {
+			resp.Results = append(resp.Results, reporter.Results()...)
+		}
+
+		rest.JSON(w, resp, http.StatusOK)
+	}))
+}
@@ -0,0 +1,135 @@
+package doorbell
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/rest"
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+// event types published on the hub
+const (
+	EventRing     = "ring"
+	EventAck      = "ack"
+	EventOpen     = "open"
+	EventClose    = "close"
+	EventOverride = "override"
+)
+
+const (
+	// number of events kept to resume interrupted streams
+	eventHistory = 100
+	// number of events buffered per subscriber before it is dropped
+	eventBuffer = 32
+	// how often the opening hours are checked for changes
+	scheduleInterval = 10 * time.Second
+	// how often a comment is sent to keep idle streams open
+	eventKeepAlive = 25 * time.Second
+)
+
+type ackEvent struct {
+	ID  string     `json:"id"`
+	Ack ringer.Ack `json:"ack"`
+}
+
+type scheduleEvent struct {
+	Open       bool `json:"open"`
+	Overridden bool `json:"overridden"`
+}
+
+func (d *Doorbell) publish(kind string, data interface{}) {
+	err := d.hub.Publish(kind, data)
+	if err != nil {
+		log.Printf("failed to publish %s event: %s", kind, err)
+	}
+}
+
+// watchSchedule publishes an event whenever the doorbell opens or closes,
+// be it because of the opening hours or an override
+func (d *Doorbell) watchSchedule() {
+	open, _ := d.isOpen(time.Now())
+	setOpenGauge(open)
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		isOpen, overridden := d.isOpen(now)
+		setOpenGauge(isOpen)
+		if isOpen == open {
+			continue
+		}
+		open = isOpen
+
+		kind := EventClose
+		if open {
+			kind = EventOpen
+		}
+		d.publish(kind, scheduleEvent{Open: open, Overridden: overridden})
+	}
+}
+
+// Hub returns the hub on which all doorbell events are published
+func (d *Doorbell) Hub() *Hub {
+	return d.hub
+}
+
+func writeEvent(w http.ResponseWriter, m Message) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", m.ID, m.Type, m.Data)
+	return err
+}
+
+// Events streams all doorbell events as server-sent events. Clients which
+// reconnect with a Last-Event-ID header receive the events they missed.
+func (d *Doorbell) Events() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if len(lastID) == 0 {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+		id, _ := strconv.ParseUint(lastID, 10, 64)
+
+		sub := d.hub.Subscribe(id)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			var err error
+			select {
+			case m, ok := <-sub.C:
+				if !ok {
+					// dropped as slow consumer, the client reconnects
+					return
+				}
+				err = writeEvent(w, m)
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}))
+}
@@ -0,0 +1,158 @@
+package doorbell
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/history"
+	"github.com/luxeria/doorbell/pkg/rest"
+	"github.com/luxeria/doorbell/pkg/rest/auth"
+	"github.com/luxeria/doorbell/pkg/ringer"
+)
+
+// recordRing records an accepted or rejected ring in the history, if enabled
+func (d *Doorbell) recordRing(r *http.Request, e ringer.Event, result string) {
+	if d.history == nil {
+		return
+	}
+
+	entry := history.Entry{
+		ID:       e.ID,
+		Time:     e.Time,
+		Subject:  e.Subject,
+		IPHash:   d.history.HashIP(r.RemoteAddr),
+		Name:     e.Name,
+		Message:  e.Message,
+		Override: e.Override,
+		Result:   result,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if c, ok := auth.ExtractJwtClaims(r); ok && len(entry.Subject) == 0 {
+		entry.Subject = c.Subject
+	}
+
+	err := d.history.Ring(entry)
+	if err != nil {
+		log.Printf("failed to record ring in history: %s", err)
+	}
+}
+
+func (d *Doorbell) recordResult(id string, err error) {
+	if d.history == nil {
+		return
+	}
+
+	result := history.ResultOK
+	if err != nil {
+		result = history.ResultError
+	}
+
+	err = d.history.Result(id, result, err)
+	if err != nil {
+		log.Printf("failed to record ring result in history: %s", err)
+	}
+}
+
+func (d *Doorbell) recordAck(id string, a ringer.Ack) {
+	if d.history == nil {
+		return
+	}
+
+	err := d.history.Acknowledge(id, a)
+	if err != nil {
+		log.Printf("failed to record acknowledgement in history: %s", err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// queryHistory returns the history entries in the time range given by the
+// from and to query parameters, responding with an error on failure
+func (d *Doorbell) queryHistory(w http.ResponseWriter, r *http.Request) ([]history.Entry, time.Time, time.Time, bool) {
+	if d.history == nil {
+		rest.Error(w, r, errors.New("ring history is disabled"), http.StatusNotFound)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	query := r.URL.Query()
+	from, err := parseTime(query.Get("from"))
+	if err != nil {
+		rest.Error(w, r, err, http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	to, err := parseTime(query.Get("to"))
+	if err != nil {
+		rest.Error(w, r, err, http.StatusBadRequest)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	entries, err := d.history.Query(from, to)
+	if err != nil {
+		rest.Error(w, r, err, http.StatusInternalServerError)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	return entries, from, to, true
+}
+
+// History exports the ring history between the optional from and to
+// timestamps (RFC 3339) as JSON or, with format=csv, as CSV
+func (d *Doorbell) History() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, _, _, ok := d.queryHistory(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			rest.JSON(w, entries, http.StatusOK)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="rings.csv"`)
+			err := history.WriteCSV(w, entries)
+			if err != nil {
+				log.Printf("failed to write response: %s", err)
+			}
+		default:
+			rest.Error(w, r, errors.New("format must be json or csv"), http.StatusBadRequest)
+		}
+	}))
+}
+
+// Stats aggregates the ring history between the optional from and to
+// timestamps (RFC 3339), served as JSON or, with format=svg, as heatmap of
+// the rings per hour of the week
+func (d *Doorbell) Stats() http.Handler {
+	return rest.GetRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, from, to, ok := d.queryHistory(w, r)
+		if !ok {
+			return
+		}
+
+		stats := history.Aggregate(entries, from, to, time.Local)
+
+		switch r.URL.Query().Get("format") {
+		case "", "json":
+			rest.JSON(w, stats, http.StatusOK)
+		case "svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			err := stats.WriteSVG(w)
+			if err != nil {
+				log.Printf("failed to write response: %s", err)
+			}
+		default:
+			rest.Error(w, r, errors.New("format must be json or svg"), http.StatusBadRequest)
+		}
+	}))
+}
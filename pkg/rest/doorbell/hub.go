@@ -0,0 +1,125 @@
+package doorbell
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Message is an event published on the hub
+type Message struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Hub is an in-process publish/subscribe hub. It keeps a history of recent
+// messages so that subscribers can resume after reconnecting. Subscribers
+// which do not keep up with the published messages are dropped.
+type Hub struct {
+	nextID      uint64
+	history     []Message
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]bool
+	mutex       sync.Mutex
+}
+
+type Subscription struct {
+	C   <-chan Message
+	c   chan Message
+	hub *Hub
+}
+
+func NewHub(historySize, bufferSize int) *Hub {
+	if historySize < 0 || bufferSize <= 0 {
+		panic("invalid hub history or buffer size")
+	}
+
+	return &Hub{
+		// start at the current time, so that message ids keep increasing
+		// across restarts and stale ids of subscribers resume correctly
+		nextID:      uint64(time.Now().UnixNano()),
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+// Publish sends a message to all subscribers
+func (h *Hub) Publish(kind string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.nextID++
+	m := Message{
+		ID:   h.nextID,
+		Type: kind,
+		Time: time.Now(),
+		Data: raw,
+	}
+
+	if h.historySize > 0 {
+		if len(h.history) >= h.historySize {
+			h.history = h.history[len(h.history)-h.historySize+1:]
+		}
+		h.history = append(h.history, m)
+	}
+
+	for s := range h.subscribers {
+		select {
+		case s.c <- m:
+		default:
+			// slow consumer, drop it
+			h.unsubscribe(s)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe registers a new subscriber. If lastID is not zero, all messages
+// from the history published after lastID are delivered first.
+func (h *Hub) Subscribe(lastID uint64) *Subscription {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var backlog []Message
+	if lastID != 0 {
+		for _, m := range h.history {
+			if m.ID > lastID {
+				backlog = append(backlog, m)
+			}
+		}
+	}
+
+	c := make(chan Message, h.bufferSize+len(backlog))
+	for _, m := range backlog {
+		c <- m
+	}
+
+	s := &Subscription{C: c, c: c, hub: h}
+	h.subscribers[s] = true
+	return s
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Close unsubscribes from the hub, closing the channel
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	s.hub.unsubscribe(s)
+}
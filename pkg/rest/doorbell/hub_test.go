@@ -0,0 +1,74 @@
+package doorbell
+
+import (
+	"testing"
+)
+
+func TestHubResume(t *testing.T) {
+	h := NewHub(3, 10)
+
+	s := h.Subscribe(0)
+	defer s.Close()
+
+	for _, kind := range []string{"a", "b", "c", "d"} {
+		h.Publish(kind, kind)
+	}
+
+	var ids []uint64
+	for i := 0; i < 4; i++ {
+		m := <-s.C
+		ids = append(ids, m.ID)
+	}
+
+	// resume after "b", only "c" and "d" are missed
+	resumed := h.Subscribe(ids[1])
+	defer resumed.Close()
+
+	for _, expected := range []string{"c", "d"} {
+		m := <-resumed.C
+		if m.Type != expected || string(m.Data) != `"`+expected+`"` {
+			t.Errorf("expected resumed message %q, got %q", expected, m.Type)
+		}
+	}
+
+	select {
+	case m := <-resumed.C:
+		t.Errorf("unexpected message %q", m.Type)
+	default:
+	}
+
+	// a fresh subscription does not receive the history
+	fresh := h.Subscribe(0)
+	defer fresh.Close()
+
+	select {
+	case m := <-fresh.C:
+		t.Errorf("unexpected message %q", m.Type)
+	default:
+	}
+}
+
+func TestHubDropsSlowConsumer(t *testing.T) {
+	h := NewHub(0, 2)
+
+	slow := h.Subscribe(0)
+	fast := h.Subscribe(0)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		h.Publish("ring", i)
+		<-fast.C
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+
+	if received != 2 {
+		t.Errorf("expected slow consumer to be dropped after 2 messages, got %d", received)
+	}
+
+	// closing a dropped subscription is harmless
+	slow.Close()
+}
@@ -0,0 +1,113 @@
+package doorbell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maximum length of the name and message left by a visitor
+	maxVisitorName    = 50
+	maxVisitorMessage = 200
+	// maximum size of the ring request body
+	maxRingRequest = 4096
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(\b[a-z][a-z0-9+.-]*://|\bwww\.)`)
+
+var errBlockedMessage = errors.New("message contains blocked content")
+
+type ringRequest struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// slackMentions replaces the opening bracket of Slack mentions such as
+// <!channel> or <!here>, and channel links
+var slackMentions = strings.NewReplacer("<!", "‹!", "<#", "‹#")
+
+// sanitize strips control and formatting characters (such as bidi overrides
+// or zero-width spaces), collapses whitespace and defuses mentions
+func sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, s)
+	return defuseMentions(strings.Join(strings.Fields(s), " "))
+}
+
+func isMentionPrefix(r rune) bool {
+	return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.+-", r))
+}
+
+// defuseMentions replaces the @ of mentions with a look-alike, so chat
+// backends do not notify whole rooms or single users, e.g. on @room
+// (Matrix), @channel or @all (Mattermost). An @ within a word, as in mail
+// addresses, is kept.
+func defuseMentions(s string) string {
+	var b strings.Builder
+	prev := ' '
+	for _, r := range s {
+		if r == '@' && isMentionPrefix(prev) {
+			r = '＠'
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return slackMentions.Replace(b.String())
+}
+
+// checkText rejects text which is too long, contains links or blocked words
+func (d *Doorbell) checkText(field, s string, max int) error {
+	if utf8.RuneCountInString(s) > max {
+		return fmt.Errorf("%s must not exceed %d characters", field, max)
+	}
+
+	if linkPattern.MatchString(s) {
+		return fmt.Errorf("%s must not contain links", field)
+	}
+
+	lower := strings.ToLower(s)
+	for _, word := range d.blockedWords {
+		if strings.Contains(lower, word) {
+			return errBlockedMessage
+		}
+	}
+
+	return nil
+}
+
+// decodeRingRequest decodes the optional body of a ring request
+func (d *Doorbell) decodeRingRequest(w http.ResponseWriter, r *http.Request) (ringRequest, error) {
+	var req ringRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRingRequest)).Decode(&req)
+	if err == io.EOF {
+		return ringRequest{}, nil
+	} else if err != nil {
+		return ringRequest{}, err
+	}
+
+	req.Name = sanitize(req.Name)
+	req.Message = sanitize(req.Message)
+
+	err = d.checkText("name", req.Name, maxVisitorName)
+	if err != nil {
+		return ringRequest{}, err
+	}
+
+	err = d.checkText("message", req.Message, maxVisitorMessage)
+	if err != nil {
+		return ringRequest{}, err
+	}
+
+	return req, nil
+}
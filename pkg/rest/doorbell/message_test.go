@@ -0,0 +1,73 @@
+package doorbell
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ratelimit"
+)
+
+func TestSanitize(t *testing.T) {
+	for in, expected := range map[string]string{
+		"  Delivery\tfor\n\nAnna ": "Delivery for Anna",
+		"evil\u202etxt.exe":        "eviltxt.exe",
+		"zero\u200bwidth\x00":      "zerowidth",
+		"@room hello @channel":     "＠room hello ＠channel",
+		"(@all) @@here":            "(＠all) ＠＠here",
+		"<!channel> <@U123>":       "‹!channel> <＠U123>",
+		"anna@example.org":         "anna@example.org",
+	} {
+		if out := sanitize(in); out != expected {
+			t.Errorf("sanitize(%q) = %q, expected %q", in, out, expected)
+		}
+	}
+}
+
+func TestDecodeRingRequest(t *testing.T) {
+	d := &Doorbell{blockedWords: []string{"spam"}}
+
+	for body, ok := range map[string]bool{
+		``:   true,
+		`{}`: true,
+		`{"name": "Anna", "message": "I'm here for the soldering workshop"}`: true,
+		`{"message": "` + strings.Repeat("a", maxVisitorMessage+1) + `"}`:    false,
+		`{"name": "` + strings.Repeat("ä", maxVisitorName) + `"}`:            true,
+		`{"message": "visit https://example.com"}`:                           false,
+		`{"message": "see www.example.com"}`:                                 false,
+		`{"message": "Buy SPAM now"}`:                                        false,
+		`{"message": 42}`:                                                    false,
+	} {
+		r := httptest.NewRequest("POST", "/ring", strings.NewReader(body))
+		_, err := d.decodeRingRequest(httptest.NewRecorder(), r)
+		if ok && err != nil {
+			t.Errorf("request %q was rejected: %s", body, err)
+		} else if !ok && err == nil {
+			t.Errorf("request %q was accepted", body)
+		}
+	}
+}
+
+func TestInvalidRingKeepsRateLimit(t *testing.T) {
+	d := newTestDoorbell(t, time.Minute)
+	d.rateLimit = ratelimit.TokenBucket(1, time.Hour)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"message": "visit https://example.com"}`, http.StatusBadRequest},
+		{`{"message": "hello"}`, http.StatusOK},
+		{`{"message": "hello again"}`, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		d.Ring().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ring", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.body, tt.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package doorbell
+
+import (
+	"github.com/luxeria/doorbell/pkg/metrics"
+)
+
+// reasons of ring outcomes
+const (
+	reasonOK          = "ok"
+	reasonClosed      = "closed"
+	reasonRateLimited = "rate-limited"
+	reasonExecError   = "exec-error"
+)
+
+var (
+	ringsTotal = metrics.NewCounterVec("doorbell_rings_total",
+		"Rings of the doorbell by outcome.", "reason")
+	openGauge = metrics.NewGauge("doorbell_open",
+		"Whether the doorbell currently accepts rings (1) or not (0).")
+)
+
+func setOpenGauge(open bool) {
+	if open {
+		openGauge.Set(1)
+	} else {
+		openGauge.Set(0)
+	}
+}
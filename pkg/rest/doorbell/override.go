@@ -0,0 +1,101 @@
+package doorbell
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/rest"
+)
+
+// Override temporarily opens or closes the doorbell regardless of the
+// regular opening hours
+type Override struct {
+	Open  bool      `json:"open"`
+	Until time.Time `json:"until"`
+}
+
+// isOpen reports whether rings are accepted at the given time, and whether
+// they are only accepted because of an override
+func (d *Doorbell) isOpen(t time.Time) (open bool, overridden bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	regular := d.openingHours.IsOpenAt(t)
+	if d.override != nil && t.Before(d.override.Until) {
+		return d.override.Open, d.override.Open && !regular
+	}
+
+	return regular, false
+}
+
+type overrideRequest struct {
+	Open     bool   `json:"open"`
+	Duration string `json:"duration"`
+}
+
+type overrideResponse struct {
+	Open     bool      `json:"open"`
+	Override *Override `json:"override"`
+}
+
+// Override allows to inspect (GET), set (POST) and clear (DELETE) an
+// override of the opening hours
+func (d *Doorbell) Override() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req overrideRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				rest.Error(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil || duration <= 0 {
+				rest.Error(w, r, errors.New("override duration must be a positive duration"), http.StatusBadRequest)
+				return
+			}
+
+			d.mutex.Lock()
+			d.override = &Override{
+				Open:  req.Open,
+				Until: time.Now().Add(duration),
+			}
+			d.mutex.Unlock()
+
+			log.Printf("opening hours overridden: open=%t for %s", req.Open, duration)
+		case http.MethodDelete:
+			d.mutex.Lock()
+			d.override = nil
+			d.mutex.Unlock()
+
+			log.Println("opening hours override cleared")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		now := time.Now()
+		open, _ := d.isOpen(now)
+		setOpenGauge(open)
+		resp := overrideResponse{Open: open}
+
+		d.mutex.Lock()
+		if d.override != nil && now.Before(d.override.Until) {
+			override := *d.override
+			resp.Override = &override
+		}
+		d.mutex.Unlock()
+
+		if r.Method != http.MethodGet {
+			d.publish(EventOverride, resp)
+		}
+
+		rest.JSON(w, resp, http.StatusOK)
+	})
+}
@@ -0,0 +1,135 @@
+package doorbell
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/rest/auth"
+	"github.com/luxeria/doorbell/pkg/websocket"
+)
+
+const (
+	// how often idle websocket clients are pinged
+	wsPingInterval = 30 * time.Second
+	// how long to wait for any frame (e.g. a pong) before giving up
+	wsReadTimeout = 2 * wsPingInterval
+	// maximum size of a command sent by a client
+	wsReadLimit = 4096
+)
+
+// command types sent by websocket clients
+const (
+	commandAck = "ack"
+)
+
+type wsCommand struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Reply   string `json:"reply"`
+	Message string `json:"message"`
+}
+
+type wsError struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+func (d *Doorbell) handleCommand(by string, data []byte) error {
+	var cmd wsCommand
+	err := json.Unmarshal(data, &cmd)
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Type {
+	case commandAck:
+		a, err := newAck(by, cmd.Reply, cmd.Message)
+		if err != nil {
+			return err
+		}
+		return d.Acknowledge(cmd.ID, a)
+	default:
+		return fmt.Errorf("unknown command %q", cmd.Type)
+	}
+}
+
+// WebSocket streams all doorbell events to interactive clients, such as a
+// door panel, and lets them reply to rings
+func (d *Doorbell) WebSocket() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			log.Printf("websocket handshake failed: %s", err)
+			return
+		}
+		// also releases the connection if the client went away without
+		// closing it
+		defer conn.Close(websocket.CloseGoingAway, "")
+
+		by := "A member"
+		if c, ok := auth.ExtractJwtClaims(r); ok && len(c.Subject) > 0 {
+			by = c.Subject
+		}
+
+		lastID, _ := strconv.ParseUint(r.URL.Query().Get("lastEventId"), 10, 64)
+		sub := d.hub.Subscribe(lastID)
+		defer sub.Close()
+
+		conn.SetReadLimit(wsReadLimit)
+		conn.SetReadTimeout(wsReadTimeout)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				op, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				if op != websocket.OpText {
+					conn.Close(websocket.CloseUnsupportedData, "expected text message")
+					return
+				}
+
+				err = d.handleCommand(by, data)
+				if err != nil {
+					var id string
+					var cmd wsCommand
+					if json.Unmarshal(data, &cmd) == nil {
+						id = cmd.ID
+					}
+					conn.WriteJSON(wsError{Type: "error", ID: id, Error: err.Error()})
+				}
+			}
+		}()
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+
+		for {
+			var err error
+			select {
+			case m, ok := <-sub.C:
+				if !ok {
+					conn.Close(websocket.CloseGoingAway, "too slow")
+					return
+				}
+				err = conn.WriteJSON(m)
+			case <-ping.C:
+				err = conn.Ping()
+			case <-closed:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	})
+}
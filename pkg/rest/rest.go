@@ -16,6 +16,16 @@ func PostRequest(h http.Handler) http.Handler {
 	})
 }
 
+func GetRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+		} else {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
 type errorResponse struct {
 	Error string `json:"error"`
 }
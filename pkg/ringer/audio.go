@@ -0,0 +1,59 @@
+package ringer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/audio"
+)
+
+// Audio rings the doorbell by playing back a sound on an audio output
+type Audio struct {
+	sound  *audio.Buffer
+	output audio.Output
+	mutex  sync.Mutex
+}
+
+func NewAudio(sound *audio.Buffer, output audio.Output, volume float64) *Audio {
+	if sound == nil {
+		panic("doorbell sound is nil")
+	}
+
+	if output == nil {
+		panic("audio output is nil")
+	}
+
+	if volume < 0 {
+		panic("audio volume must not be negative")
+	}
+
+	return &Audio{
+		sound:  sound.Scale(volume),
+		output: output,
+	}
+}
+
+// Check verifies that the audio output is writable, if supported
+func (a *Audio) Check(ctx context.Context) error {
+	if checker, ok := a.output.(audio.Checker); ok {
+		return checker.Check()
+	}
+	return nil
+}
+
+func (a *Audio) Ring(ctx context.Context, e Event) error {
+	// the audio device can only be opened once, play back rings in sequence
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	err = a.output.Play(a.sound)
+	chimeDuration.With().Observe(time.Since(started).Seconds())
+	return err
+}
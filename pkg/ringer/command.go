@@ -0,0 +1,188 @@
+package ringer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/metrics"
+)
+
+// maximum number of bytes captured per output stream
+const maxCommandOutput = 4096
+
+var chimeDuration = metrics.NewHistogramVec("doorbell_chime_duration_seconds",
+	"Duration of playing back the doorbell chime.",
+	[]float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30})
+
+// Result records the outcome of a single command execution
+type Result struct {
+	RingID     string    `json:"ring_id"`
+	Command    []string  `json:"command"`
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Reporter is implemented by ringers which keep a record of recent results
+type Reporter interface {
+	Results() []Result
+}
+
+// limitedBuffer keeps the first max bytes written to it and silently
+// discards the rest, so the command never blocks on a full pipe
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.max - b.buf.Len(); n > remaining {
+		p = p[:remaining]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[truncated]"
+	}
+	return b.buf.String()
+}
+
+// Command rings the doorbell by executing an external command. Details of
+// the ring are passed in DOORBELL_* environment variables.
+type Command struct {
+	args    []string
+	history int
+	results []Result
+	mutex   sync.Mutex
+}
+
+func NewCommand(args []string, history int) *Command {
+	if len(args) == 0 {
+		panic("doorbell command is empty")
+	}
+
+	if history < 0 {
+		panic("command history size must not be negative")
+	}
+
+	return &Command{
+		args:    args,
+		history: history,
+	}
+}
+
+func (c *Command) Ring(ctx context.Context, e Event) error {
+	stdout := &limitedBuffer{max: maxCommandOutput}
+	stderr := &limitedBuffer{max: maxCommandOutput}
+
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"DOORBELL_RING_ID="+e.ID,
+		"DOORBELL_SUBJECT="+e.Subject,
+		"DOORBELL_NAME="+e.Name,
+		"DOORBELL_MESSAGE="+e.Message,
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	started := time.Now()
+	err := cmd.Run()
+	chimeDuration.With().Observe(time.Since(started).Seconds())
+
+	result := Result{
+		RingID:     e.ID,
+		Command:    c.args,
+		Started:    started,
+		DurationMs: time.Since(started).Nanoseconds() / int64(time.Millisecond),
+		ExitCode:   -1,
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+	}
+
+	if cmd.ProcessState != nil {
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+			result.ExitCode = status.ExitStatus()
+		}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	c.record(result)
+
+	if err != nil {
+		args := strings.Join(c.args, " ")
+		if output := strings.TrimSpace(result.Stderr); len(output) > 0 {
+			return fmt.Errorf("command `%s` failed (%s): %s", args, err, output)
+		}
+		return fmt.Errorf("command `%s` failed: %s", args, err)
+	}
+
+	return nil
+}
+
+// Check verifies that the command exists and that its arguments referring
+// to files (such as the doorbell sound) are present
+func (c *Command) Check(ctx context.Context) error {
+	_, err := exec.LookPath(c.args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range c.args[1:] {
+		if strings.HasPrefix(arg, "-") || !strings.ContainsRune(arg, filepath.Separator) {
+			continue
+		}
+
+		_, err = os.Stat(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Command) record(r Result) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.history == 0 {
+		return
+	}
+
+	if len(c.results) >= c.history {
+		c.results = c.results[len(c.results)-c.history+1:]
+	}
+	c.results = append(c.results, r)
+}
+
+// Results returns the recorded results, most recent first
+func (c *Command) Results() []Result {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	results := make([]Result, len(c.results))
+	for i, r := range c.results {
+		results[len(results)-1-i] = r
+	}
+	return results
+}
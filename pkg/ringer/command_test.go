@@ -0,0 +1,78 @@
+package ringer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommandResults(t *testing.T) {
+	c := NewCommand([]string{"sh", "-c", `echo "ring $0"; echo oops >&2; exit 3`}, 2)
+
+	err := c.Ring(context.Background(), Event{ID: "first"})
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("expected error containing stderr, got %v", err)
+	}
+
+	results := c.Results()
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %d", len(results))
+	}
+
+	r := results[0]
+	if r.RingID != "first" || r.ExitCode != 3 || r.Stdout != "ring sh\n" || r.Stderr != "oops\n" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	c.Ring(context.Background(), Event{ID: "second"})
+	c.Ring(context.Background(), Event{ID: "third"})
+
+	results = c.Results()
+	if len(results) != 2 || results[0].RingID != "third" || results[1].RingID != "second" {
+		t.Errorf("unexpected history: %+v", results)
+	}
+}
+
+func TestCommandOutputLimit(t *testing.T) {
+	c := NewCommand([]string{"sh", "-c", "head -c 100000 /dev/zero"}, 1)
+
+	err := c.Ring(context.Background(), Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := c.Results()[0]
+	if r.ExitCode != 0 || !strings.HasSuffix(r.Stdout, "[truncated]") || len(r.Stdout) > maxCommandOutput+20 {
+		t.Errorf("output was not truncated: exit code %d, %d bytes", r.ExitCode, len(r.Stdout))
+	}
+}
+
+func TestCommandEnvironment(t *testing.T) {
+	c := NewCommand([]string{"sh", "-c", `printf "%s|%s" "$DOORBELL_NAME" "$DOORBELL_MESSAGE"`}, 1)
+
+	err := c.Ring(context.Background(), Event{Name: "Anna", Message: "Delivery; $(reboot)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := c.Results()[0].Stdout; out != "Anna|Delivery; $(reboot)" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestCommandCheck(t *testing.T) {
+	ok := NewCommand([]string{"sh", "-c", "true", "../../assets/dingdong.wav"}, 0)
+	if err := ok.Check(context.Background()); err != nil {
+		t.Errorf("unexpected check failure: %s", err)
+	}
+
+	missingCommand := NewCommand([]string{"no-such-player", "sound.mp3"}, 0)
+	if missingCommand.Check(context.Background()) == nil {
+		t.Error("missing command passed the check")
+	}
+
+	missingFile := NewCommand([]string{"sh", "../../assets/no-such-sound.mp3"}, 0)
+	if missingFile.Check(context.Background()) == nil {
+		t.Error("missing sound file passed the check")
+	}
+}
@@ -0,0 +1,223 @@
+package ringer
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"log"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/mail"
+)
+
+const defaultMailText = `{{ define "ring" -}}
+The doorbell was rung outside of the regular opening hours, as they are currently overridden.
+
+Time:    {{ .Time.Format "Mon Jan 2 15:04:05 2006" }}
+Subject: {{ .Subject }}
+{{- if .Name }}
+Name:    {{ .Name }}
+{{- end }}
+{{- if .Message }}
+Message: {{ .Message }}
+{{- end }}
+{{ end }}
+{{- define "digest" -}}
+Doorbell digest from {{ .From.Format "Mon Jan 2 15:04" }} to {{ .To.Format "Mon Jan 2 15:04" }}
+
+Rings:           {{ .Rings }}
+Outside hours:   {{ .Overrides }}
+Acknowledged:    {{ .Acknowledged }}
+{{ end }}`
+
+const defaultMailHTML = `{{ define "ring" -}}
+<p>The doorbell was rung outside of the regular opening hours, as they are currently overridden.</p>
+<table>
+<tr><th align="left">Time</th><td>{{ .Time.Format "Mon Jan 2 15:04:05 2006" }}</td></tr>
+<tr><th align="left">Subject</th><td>{{ .Subject }}</td></tr>
+{{- if .Name }}
+<tr><th align="left">Name</th><td>{{ .Name }}</td></tr>
+{{- end }}
+{{- if .Message }}
+<tr><th align="left">Message</th><td>{{ .Message }}</td></tr>
+{{- end }}
+</table>
+{{ end }}
+{{- define "digest" -}}
+<p>Doorbell digest from {{ .From.Format "Mon Jan 2 15:04" }} to {{ .To.Format "Mon Jan 2 15:04" }}</p>
+<table>
+<tr><th align="left">Rings</th><td>{{ .Rings }}</td></tr>
+<tr><th align="left">Outside hours</th><td>{{ .Overrides }}</td></tr>
+<tr><th align="left">Acknowledged</th><td>{{ .Acknowledged }}</td></tr>
+</table>
+{{ end }}`
+
+// MailTemplates contain a "ring" and a "digest" template each
+type MailTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// ParseMailTemplates parses the text and HTML mail templates from the given
+// files, using the built-in templates for empty paths
+func ParseMailTemplates(textFile, htmlFile string) (*MailTemplates, error) {
+	var err error
+	t := &MailTemplates{}
+
+	if len(textFile) > 0 {
+		t.text, err = texttemplate.ParseFiles(textFile)
+	} else {
+		t.text, err = texttemplate.New("mail").Parse(defaultMailText)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(htmlFile) > 0 {
+		t.html, err = htmltemplate.ParseFiles(htmlFile)
+	} else {
+		t.html, err = htmltemplate.New("mail").Parse(defaultMailHTML)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *MailTemplates) render(name string, data interface{}) (text, html string, err error) {
+	var textBuf, htmlBuf bytes.Buffer
+
+	err = t.text.ExecuteTemplate(&textBuf, name, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = t.html.ExecuteTemplate(&htmlBuf, name, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// Digest summarizes the rings within a period
+type Digest struct {
+	From         time.Time
+	To           time.Time
+	Rings        int
+	Overrides    int
+	Acknowledged int
+}
+
+// DigestFunc computes the digest of a period from a persistent record of
+// the rings
+type DigestFunc func(from, to time.Time) (Digest, error)
+
+// Mail sends a mail for rings which only went through because the opening
+// hours were overridden, and a daily digest of all rings. Without a
+// DigestFunc, the digest is counted in memory and lost on restart.
+type Mail struct {
+	mailer    *mail.Mailer
+	templates *MailTemplates
+	source    DigestFunc
+	digest    Digest
+	mutex     sync.Mutex
+}
+
+func NewMail(mailer *mail.Mailer, templates *MailTemplates, source DigestFunc) *Mail {
+	if mailer == nil {
+		panic("mailer is nil")
+	}
+
+	if templates == nil {
+		panic("mail templates are nil")
+	}
+
+	return &Mail{
+		mailer:    mailer,
+		templates: templates,
+		source:    source,
+		digest:    Digest{From: time.Now()},
+	}
+}
+
+func (m *Mail) Ring(ctx context.Context, e Event) error {
+	m.mutex.Lock()
+	m.digest.Rings++
+	if e.Override {
+		m.digest.Overrides++
+	}
+	m.mutex.Unlock()
+
+	if !e.Override {
+		return nil
+	}
+
+	text, html, err := m.templates.render("ring", e)
+	if err != nil {
+		return err
+	}
+
+	return m.mailer.Send(ctx, "Doorbell rang outside opening hours", text, html)
+}
+
+func (m *Mail) Acknowledge(ctx context.Context, e Event, a Ack) error {
+	m.mutex.Lock()
+	m.digest.Acknowledged++
+	m.mutex.Unlock()
+	return nil
+}
+
+// SendDigest sends the digest of all rings since the last digest
+func (m *Mail) SendDigest(ctx context.Context) error {
+	m.mutex.Lock()
+	d := m.digest
+	d.To = time.Now()
+	m.digest = Digest{From: d.To}
+	m.mutex.Unlock()
+
+	if m.source != nil {
+		var err error
+		d, err = m.source(d.From, d.To)
+		if err != nil {
+			return err
+		}
+	}
+
+	text, html, err := m.templates.render("digest", d)
+	if err != nil {
+		return err
+	}
+
+	return m.mailer.Send(ctx, "Doorbell daily digest", text, html)
+}
+
+// nextDaily returns the next point in time after now at the given time of day
+func nextDaily(now time.Time, at time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunDigest sends the digest every day at the given time of day until the
+// context is cancelled
+func (m *Mail) RunDigest(ctx context.Context, at time.Time) {
+	for {
+		timer := time.NewTimer(time.Until(nextDaily(time.Now(), at)))
+		select {
+		case <-timer.C:
+			err := m.SendDigest(ctx)
+			if err != nil {
+				log.Printf("failed to send mail digest: %s", err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
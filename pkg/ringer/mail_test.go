@@ -0,0 +1,218 @@
+package ringer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/mail"
+)
+
+// fakeSMTP is an in-process stand-in for an SMTP server
+type fakeSMTP struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	auth     []string
+	mails    []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSMTP{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch cmd {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			s.mutex.Lock()
+			s.auth = append(s.auth, string(credentials))
+			s.mutex.Unlock()
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL", "RCPT":
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mutex.Lock()
+			s.mails = append(s.mails, data.String())
+			s.mutex.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestMail(t *testing.T) {
+	server := newFakeSMTP(t)
+	defer server.listener.Close()
+
+	mailer, err := mail.New(mail.Config{
+		Addr:     server.listener.Addr().String(),
+		Username: "bell",
+		Password: "secret",
+		From:     "doorbell@example.org",
+		To:       []string{"board@example.org"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := ParseMailTemplates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMail(mailer, templates, nil)
+	ctx := context.Background()
+
+	// regular rings are only counted
+	err = m.Ring(ctx, Event{ID: "1", Time: time.Now(), Subject: "Anonymous"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Ring(ctx, Event{ID: "2", Time: time.Now(), Subject: "Anonymous", Override: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Acknowledge(ctx, Event{ID: "2"}, Ack{By: "Anna"})
+
+	err = m.SendDigest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.mails) != 2 {
+		t.Fatalf("expected 2 mails, got %d", len(server.mails))
+	}
+
+	if len(server.auth) != 2 || server.auth[0] != "\x00bell\x00secret" {
+		t.Errorf("unexpected authentication: %q", server.auth)
+	}
+
+	ring := server.mails[0]
+	for _, expected := range []string{"Subject: Doorbell rang outside opening hours", "multipart/alternative", "text/html", "Subject: Anonymous"} {
+		if !strings.Contains(ring, expected) {
+			t.Errorf("ring mail does not contain %q:\n%s", expected, ring)
+		}
+	}
+
+	digest := server.mails[1]
+	for _, expected := range []string{"Subject: Doorbell daily digest", "Rings:           2", "Outside hours:   1", "Acknowledged:    1"} {
+		if !strings.Contains(digest, expected) {
+			t.Errorf("digest mail does not contain %q:\n%s", expected, digest)
+		}
+	}
+}
+
+func TestMailDigestSource(t *testing.T) {
+	server := newFakeSMTP(t)
+	defer server.listener.Close()
+
+	mailer, err := mail.New(mail.Config{
+		Addr: server.listener.Addr().String(),
+		From: "doorbell@example.org",
+		To:   []string{"board@example.org"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := ParseMailTemplates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var from time.Time
+	m := NewMail(mailer, templates, func(f, to time.Time) (Digest, error) {
+		from = f
+		return Digest{From: f, To: to, Rings: 7}, nil
+	})
+
+	start := time.Now()
+	err = m.SendDigest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from.Before(start.Add(-time.Second)) || from.After(start) {
+		t.Errorf("unexpected digest period start %s", from)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.mails) != 1 || !strings.Contains(server.mails[0], "Rings:           7") {
+		t.Errorf("digest was not computed by the source: %q", server.mails)
+	}
+}
+
+func TestNextDaily(t *testing.T) {
+	at, _ := time.Parse("15:04", "08:00")
+	now := time.Date(2006, time.January, 2, 7, 0, 0, 0, time.UTC)
+
+	if next := nextDaily(now, at); !next.Equal(time.Date(2006, time.January, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next digest time %s", next)
+	}
+
+	now = time.Date(2006, time.January, 2, 8, 0, 0, 0, time.UTC)
+	if next := nextDaily(now, at); !next.Equal(time.Date(2006, time.January, 3, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next digest time %s", next)
+	}
+}
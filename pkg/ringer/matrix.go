@@ -0,0 +1,110 @@
+package ringer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/matrix"
+)
+
+// how long ring announcements are remembered for follow-ups
+const matrixFollowUpWindow = time.Hour
+
+type matrixAnnouncement struct {
+	time     time.Time
+	eventIDs map[string]string
+}
+
+// Matrix announces rings in one or more Matrix rooms and replies to the
+// announcement once someone acknowledged the ring
+type Matrix struct {
+	client        *matrix.Client
+	rooms         []string
+	announcements map[string]*matrixAnnouncement
+	mutex         sync.Mutex
+}
+
+func NewMatrix(client *matrix.Client, rooms []string) *Matrix {
+	if client == nil {
+		panic("matrix client is nil")
+	}
+
+	if len(rooms) == 0 {
+		panic("matrix rooms are empty")
+	}
+
+	return &Matrix{
+		client:        client,
+		rooms:         rooms,
+		announcements: make(map[string]*matrixAnnouncement),
+	}
+}
+
+func (m *Matrix) Ring(ctx context.Context, e Event) error {
+	announcement := &matrixAnnouncement{
+		time:     e.Time,
+		eventIDs: make(map[string]string),
+	}
+
+	var errs []error
+	for _, room := range m.rooms {
+		eventID, err := m.client.SendMessage(ctx, room, "ring-"+e.ID, matrix.Message{
+			MsgType: "m.text",
+			Body:    e.Text(),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify matrix room %s: %s", room, err))
+			continue
+		}
+		announcement.eventIDs[room] = eventID
+	}
+
+	m.remember(e.ID, announcement)
+	return joinErrors(errs)
+}
+
+func (m *Matrix) remember(ringID string, a *matrixAnnouncement) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, old := range m.announcements {
+		if time.Since(old.time) > matrixFollowUpWindow {
+			delete(m.announcements, id)
+		}
+	}
+	m.announcements[ringID] = a
+}
+
+func (m *Matrix) Acknowledge(ctx context.Context, e Event, a Ack) error {
+	m.mutex.Lock()
+	announcement, ok := m.announcements[e.ID]
+	m.mutex.Unlock()
+
+	// the announcement may have failed or been forgotten after a restart
+	if !ok {
+		return nil
+	}
+
+	// each reply is a transaction of its own, the homeserver would drop a
+	// changed reply as a retry otherwise
+	txnID := "ack-" + e.ID + "-" + a.Reply + "-" + strconv.FormatInt(a.Time.UnixNano(), 10)
+
+	var errs []error
+	for room, eventID := range announcement.eventIDs {
+		_, err := m.client.SendMessage(ctx, room, txnID, matrix.Message{
+			MsgType: "m.notice",
+			Body:    a.Text(),
+			RelatesTo: &matrix.RelatesTo{
+				InReplyTo: &matrix.InReplyTo{EventID: eventID},
+			},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to follow up in matrix room %s: %s", room, err))
+		}
+	}
+
+	return joinErrors(errs)
+}
@@ -0,0 +1,137 @@
+package ringer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/matrix"
+)
+
+// fakeHomeserver is a stand-in for the message sending part of the Matrix
+// client-server API
+type fakeHomeserver struct {
+	mutex    sync.Mutex
+	messages map[string]matrix.Message
+	events   map[string]string
+}
+
+func (h *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token"}`)
+		return
+	}
+
+	const prefix = "/_matrix/client/v3/rooms/"
+	if r.Method != http.MethodPut || !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var m matrix.Message
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// transactions are idempotent
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	eventID, ok := h.events[key]
+	if !ok {
+		eventID = fmt.Sprintf("$event%d", len(h.events))
+		h.events[key] = eventID
+		h.messages[key] = m
+	}
+
+	fmt.Fprintf(w, `{"event_id":%q}`, eventID)
+}
+
+func TestMatrix(t *testing.T) {
+	hs := &fakeHomeserver{
+		messages: make(map[string]matrix.Message),
+		events:   make(map[string]string),
+	}
+	server := httptest.NewServer(hs)
+	defer server.Close()
+
+	m := NewMatrix(matrix.New(matrix.Config{
+		Homeserver:  server.URL,
+		AccessToken: "token",
+	}), []string{"!room:example.org"})
+
+	ctx := context.Background()
+	e := Event{ID: "42", Time: time.Now()}
+
+	// ringing twice must not announce twice
+	for i := 0; i < 2; i++ {
+		err := m.Ring(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	acked := time.Unix(1700000000, 0)
+	for _, a := range []Ack{
+		{By: "Anna", Reply: ReplyComing, Time: acked},
+		{By: "Anna", Reply: ReplyNobody, Time: acked.Add(time.Minute)},
+	} {
+		err := m.Acknowledge(ctx, e, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a changed reply must not be taken for a retry of the first one
+	if len(hs.messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(hs.messages))
+	}
+
+	ring := hs.messages["!room:example.org/send/m.room.message/ring-42"]
+	if ring.Body != "Someone is at the door!" {
+		t.Errorf("unexpected ring message: %+v", ring)
+	}
+
+	ack := hs.messages["!room:example.org/send/m.room.message/ack-42-coming-1700000000000000000"]
+	if ack.Body != "Anna is on their way to the door." {
+		t.Errorf("unexpected acknowledgement message: %+v", ack)
+	}
+
+	if ack.RelatesTo == nil || ack.RelatesTo.InReplyTo == nil || ack.RelatesTo.InReplyTo.EventID != "$event0" {
+		t.Errorf("acknowledgement does not reply to the ring announcement: %+v", ack.RelatesTo)
+	}
+
+	err := m.Acknowledge(ctx, Event{ID: "unknown"}, Ack{By: "Anna"})
+	if err != nil {
+		t.Errorf("expected acknowledgement of unknown ring to be ignored: %s", err)
+	}
+
+	if len(hs.messages) != 3 {
+		t.Errorf("acknowledgement of unknown ring was sent")
+	}
+}
+
+func TestMatrixUnauthorized(t *testing.T) {
+	server := httptest.NewServer(&fakeHomeserver{})
+	defer server.Close()
+
+	m := NewMatrix(matrix.New(matrix.Config{
+		Homeserver:  server.URL,
+		AccessToken: "wrong",
+	}), []string{"!room:example.org"})
+
+	err := m.Ring(context.Background(), Event{ID: "1"})
+	if err == nil || !strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+}
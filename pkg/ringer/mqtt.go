@@ -0,0 +1,46 @@
+package ringer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/luxeria/doorbell/pkg/mqtt"
+)
+
+// MQTT publishes each ring as JSON encoded event to a topic
+type MQTT struct {
+	client *mqtt.Client
+	topic  string
+	qos    byte
+	retain bool
+}
+
+func NewMQTT(client *mqtt.Client, topic string, qos int, retain bool) *MQTT {
+	if client == nil {
+		panic("mqtt client is nil")
+	}
+
+	if len(topic) == 0 {
+		panic("mqtt topic is empty")
+	}
+
+	if qos < 0 || qos > 1 {
+		panic("mqtt qos must be 0 or 1")
+	}
+
+	return &MQTT{
+		client: client,
+		topic:  topic,
+		qos:    byte(qos),
+		retain: retain,
+	}
+}
+
+func (m *MQTT) Ring(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return m.client.Publish(ctx, m.topic, payload, m.qos, m.retain)
+}
@@ -0,0 +1,91 @@
+package ringer
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ntfy"
+)
+
+type NtfyConfig struct {
+	Title    string
+	Priority string
+	Tags     []string
+	Click    string
+	// Dedup suppresses notifications for rings following within this
+	// window after the last notification
+	Dedup time.Duration
+}
+
+// Ntfy publishes a push notification for each ring to an ntfy topic
+type Ntfy struct {
+	client   *ntfy.Client
+	config   NtfyConfig
+	lastRing time.Time
+	mutex    sync.Mutex
+}
+
+func NewNtfy(client *ntfy.Client, c NtfyConfig) *Ntfy {
+	if client == nil {
+		panic("ntfy client is nil")
+	}
+
+	if c.Dedup < 0 {
+		panic("ntfy dedup window must not be negative")
+	}
+
+	return &Ntfy{
+		client: client,
+		config: c,
+	}
+}
+
+// reserve starts the dedup window for the ring, unless a notification was
+// sent or is being sent recently. The previous start of the window is
+// returned to restore it, if the notification fails.
+func (n *Ntfy) reserve(e Event) (previous time.Time, ok bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.lastRing.IsZero() && e.Time.Sub(n.lastRing) < n.config.Dedup {
+		return time.Time{}, false
+	}
+
+	previous = n.lastRing
+	n.lastRing = e.Time
+	return previous, true
+}
+
+// release gives up the dedup window of a ring which could not be notified
+func (n *Ntfy) release(e Event, previous time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.lastRing.Equal(e.Time) {
+		n.lastRing = previous
+	}
+}
+
+func (n *Ntfy) Ring(ctx context.Context, e Event) error {
+	previous, ok := n.reserve(e)
+	if !ok {
+		log.Printf("suppressing ntfy notification for ring %s", e.ID)
+		return nil
+	}
+
+	err := n.client.Publish(ctx, ntfy.Message{
+		Title:    n.config.Title,
+		Body:     e.Text(),
+		Priority: n.config.Priority,
+		Tags:     n.config.Tags,
+		Click:    n.config.Click,
+	})
+	if err != nil {
+		n.release(e, previous)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package ringer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/ntfy"
+)
+
+func TestNtfy(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	n := NewNtfy(ntfy.New(ntfy.Config{
+		TopicURL: server.URL + "/doorbell",
+		Token:    "tk_secret",
+	}), NtfyConfig{
+		Title:    "Doorbell",
+		Priority: "high",
+		Tags:     []string{"bell", "door"},
+		Dedup:    time.Minute,
+	})
+
+	now := time.Now()
+	for _, offset := range []time.Duration{0, 10 * time.Second, 2 * time.Minute} {
+		err := n.Ring(context.Background(), Event{Time: now.Add(offset)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected burst to be deduplicated into 2 notifications, got %d", len(requests))
+	}
+
+	r := requests[0]
+	if r.URL.Path != "/doorbell" || r.Header.Get("Title") != "Doorbell" || r.Header.Get("Priority") != "high" ||
+		r.Header.Get("Tags") != "bell,door" || r.Header.Get("Authorization") != "Bearer tk_secret" {
+		t.Errorf("unexpected request: %s %v", r.URL, r.Header)
+	}
+
+	if bodies[0] != "Someone is at the door!" {
+		t.Errorf("unexpected body %q", bodies[0])
+	}
+}
+
+func TestNtfyFailureDoesNotSuppress(t *testing.T) {
+	fail := true
+	var published int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		published++
+	}))
+	defer server.Close()
+
+	n := NewNtfy(ntfy.New(ntfy.Config{
+		TopicURL: server.URL + "/doorbell",
+	}), NtfyConfig{
+		Dedup: time.Minute,
+	})
+
+	now := time.Now()
+	err := n.Ring(context.Background(), Event{Time: now})
+	if err == nil {
+		t.Fatal("expected failed publish to be reported")
+	}
+
+	fail = false
+	err = n.Ring(context.Background(), Event{Time: now.Add(10 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published != 1 {
+		t.Errorf("expected ring after failed publish to be notified, got %d notifications", published)
+	}
+}
+
+func TestNtfyConcurrentRings(t *testing.T) {
+	var published int32
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&published, 1)
+		received <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	n := NewNtfy(ntfy.New(ntfy.Config{
+		TopicURL: server.URL + "/doorbell",
+	}), NtfyConfig{
+		Dedup: time.Minute,
+	})
+
+	now := time.Now()
+	first := make(chan error, 1)
+	go func() {
+		first <- n.Ring(context.Background(), Event{Time: now})
+	}()
+	<-received
+
+	// rings arriving while the first notification is still being published
+	var wg sync.WaitGroup
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(offset time.Duration) {
+			defer wg.Done()
+			err := n.Ring(context.Background(), Event{Time: now.Add(offset)})
+			if err != nil {
+				t.Error(err)
+			}
+		}(time.Duration(i) * time.Second)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("rings were not suppressed while a notification was being published")
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&published); n != 1 {
+		t.Errorf("expected exactly one notification, got %d", n)
+	}
+}
@@ -0,0 +1,189 @@
+package ringer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event describes a single ring of the doorbell
+type Event struct {
+	ID      string    `json:"id"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"timestamp"`
+	// Name and Message are optionally left by whoever is ringing
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	// Override is set if the ring was only accepted because the opening
+	// hours were overridden
+	Override bool `json:"override"`
+}
+
+// Text returns a human readable description of the ring
+func (e Event) Text() string {
+	who := "Someone"
+	if len(e.Name) > 0 {
+		who = e.Name
+	}
+
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("%s is at the door: %s", who, e.Message)
+	}
+	return fmt.Sprintf("%s is at the door!", who)
+}
+
+// possible replies acknowledging a ring
+const (
+	ReplyComing = "coming"
+	ReplyWait   = "wait"
+	ReplyNobody = "nobody"
+)
+
+// Ack is the reply of someone who noticed a ring
+type Ack struct {
+	By    string    `json:"by"`
+	Reply string    `json:"reply"`
+	Time  time.Time `json:"timestamp"`
+	// Message is an optional note for whoever is ringing
+	Message string `json:"message,omitempty"`
+}
+
+// Text returns a human readable description of the acknowledgement
+func (a Ack) Text() string {
+	switch a.Reply {
+	case ReplyComing:
+		return fmt.Sprintf("%s is on their way to the door.", a.By)
+	case ReplyWait:
+		return fmt.Sprintf("%s asks to wait a moment.", a.By)
+	case ReplyNobody:
+		return fmt.Sprintf("%s says nobody is here to open the door.", a.By)
+	default:
+		return fmt.Sprintf("%s acknowledged the ring.", a.By)
+	}
+}
+
+// Ringer notifies about a doorbell event. Ring blocks until the
+// notification has been delivered (or failed).
+type Ringer interface {
+	Ring(ctx context.Context, e Event) error
+}
+
+// Acknowledger is implemented by ringers which follow up on acknowledgements
+type Acknowledger interface {
+	Acknowledge(ctx context.Context, e Event, a Ack) error
+}
+
+// AcknowledgeFunc records an acknowledgement of the ring with the given ID
+type AcknowledgeFunc func(ringID string, a Ack) error
+
+// Listener is implemented by ringers whose recipients can acknowledge rings.
+// Listen blocks until the context is cancelled, passing received
+// acknowledgements to the given function.
+type Listener interface {
+	Listen(ctx context.Context, acknowledge AcknowledgeFunc)
+}
+
+// Checker is implemented by ringers which can check whether they are able
+// to ring, without actually ringing
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Multi rings all of its ringers concurrently
+type Multi []Ringer
+
+func (m Multi) Ring(ctx context.Context, e Event) error {
+	errs := make([]error, len(m))
+
+	var wg sync.WaitGroup
+	for i, r := range m {
+		wg.Add(1)
+		go func(i int, r Ringer) {
+			defer wg.Done()
+			errs[i] = r.Ring(ctx, e)
+		}(i, r)
+	}
+	wg.Wait()
+
+	return joinErrors(errs)
+}
+
+// Acknowledge forwards the acknowledgement to all ringers implementing
+// Acknowledger
+func (m Multi) Acknowledge(ctx context.Context, e Event, a Ack) error {
+	errs := make([]error, len(m))
+
+	var wg sync.WaitGroup
+	for i, r := range m {
+		if acknowledger, ok := r.(Acknowledger); ok {
+			wg.Add(1)
+			go func(i int, acknowledger Acknowledger) {
+				defer wg.Done()
+				errs[i] = acknowledger.Acknowledge(ctx, e, a)
+			}(i, acknowledger)
+		}
+	}
+	wg.Wait()
+
+	return joinErrors(errs)
+}
+
+// Listen listens on all ringers implementing Listener
+func (m Multi) Listen(ctx context.Context, acknowledge AcknowledgeFunc) {
+	var wg sync.WaitGroup
+	for _, r := range m {
+		if listener, ok := r.(Listener); ok {
+			wg.Add(1)
+			go func(listener Listener) {
+				defer wg.Done()
+				listener.Listen(ctx, acknowledge)
+			}(listener)
+		}
+	}
+	wg.Wait()
+}
+
+// Results collects the results of all ringers which keep a record of them
+func (m Multi) Results() []Result {
+	var results []Result
+	for _, r := range m {
+		if reporter, ok := r.(Reporter); ok {
+			results = append(results, reporter.Results()...)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Started.After(results[j].Started)
+	})
+	return results
+}
+
+// Check checks all ringers which support it
+func (m Multi) Check(ctx context.Context) error {
+	var errs []error
+	for _, r := range m {
+		if checker, ok := r.(Checker); ok {
+			errs = append(errs, checker.Check(ctx))
+		}
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
+	var messages []string
+	for _, err := range errs {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(messages, "; "))
+}
@@ -0,0 +1,183 @@
+package ringer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/audio"
+)
+
+// SpeechOutputPlaceholder is replaced with the path of a temporary file in
+// the synthesizer arguments. If it is missing, the synthesizer is expected
+// to write the wave file to stdout.
+const SpeechOutputPlaceholder = "{output}"
+
+// how long the synthesizer may take to render a message
+const speechTimeout = 30 * time.Second
+
+// Speech rings a chime, followed by a spoken announcement of the visitor's
+// message. The text is passed to the synthesizer command on stdin.
+type Speech struct {
+	chime      Ringer
+	synth      []string
+	output     audio.Output
+	cacheSize  int
+	cache      map[string]*audio.Buffer
+	cacheOrder []string
+	cacheMutex sync.Mutex
+	// serializes playback of chime and announcement
+	mutex sync.Mutex
+}
+
+func NewSpeech(chime Ringer, synth []string, output audio.Output, cacheSize int) *Speech {
+	if chime == nil {
+		panic("chime ringer is nil")
+	}
+
+	if len(synth) == 0 {
+		panic("speech synthesizer command is empty")
+	}
+
+	if output == nil {
+		panic("audio output is nil")
+	}
+
+	if cacheSize < 0 {
+		panic("speech cache size must not be negative")
+	}
+
+	return &Speech{
+		chime:     chime,
+		synth:     synth,
+		output:    output,
+		cacheSize: cacheSize,
+		cache:     make(map[string]*audio.Buffer),
+	}
+}
+
+func (s *Speech) Ring(ctx context.Context, e Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.chime.Ring(ctx, e)
+	if err != nil || len(e.Message) == 0 {
+		return err
+	}
+
+	// a failed announcement is not worth failing the ring over, the chime
+	// has been played already
+	sound, err := s.render(ctx, e.Text())
+	if err != nil {
+		log.Printf("speech synthesis failed, only played the chime: %s", err)
+		return nil
+	}
+
+	err = s.output.Play(sound)
+	if err != nil {
+		log.Printf("playing back announcement failed: %s", err)
+	}
+
+	return nil
+}
+
+// Results forwards the results of the chime, if any
+func (s *Speech) Results() []Result {
+	if reporter, ok := s.chime.(Reporter); ok {
+		return reporter.Results()
+	}
+	return nil
+}
+
+// Check forwards to the chime. A broken synthesizer is not checked, as
+// rings fall back to the chime without the announcement.
+func (s *Speech) Check(ctx context.Context) error {
+	if checker, ok := s.chime.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+func (s *Speech) render(ctx context.Context, text string) (*audio.Buffer, error) {
+	sum := sha256.Sum256([]byte(text))
+	key := hex.EncodeToString(sum[:])
+
+	s.cacheMutex.Lock()
+	sound, ok := s.cache[key]
+	s.cacheMutex.Unlock()
+	if ok {
+		return sound, nil
+	}
+
+	sound, err := s.synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMutex.Lock()
+	defer s.cacheMutex.Unlock()
+
+	if s.cacheSize > 0 {
+		if len(s.cacheOrder) >= s.cacheSize {
+			delete(s.cache, s.cacheOrder[0])
+			s.cacheOrder = s.cacheOrder[1:]
+		}
+		s.cache[key] = sound
+		s.cacheOrder = append(s.cacheOrder, key)
+	}
+
+	return sound, nil
+}
+
+func (s *Speech) synthesize(ctx context.Context, text string) (*audio.Buffer, error) {
+	ctx, cancel := context.WithTimeout(ctx, speechTimeout)
+	defer cancel()
+
+	var outputFile string
+	args := make([]string, len(s.synth))
+	for i, arg := range s.synth {
+		if strings.Contains(arg, SpeechOutputPlaceholder) {
+			if len(outputFile) == 0 {
+				f, err := ioutil.TempFile("", "doorbell-speech-*.wav")
+				if err != nil {
+					return nil, err
+				}
+				f.Close()
+				defer os.Remove(f.Name())
+				outputFile = f.Name()
+			}
+			arg = strings.Replace(arg, SpeechOutputPlaceholder, outputFile, -1)
+		}
+		args[i] = arg
+	}
+
+	var stdout bytes.Buffer
+	stderr := &limitedBuffer{max: maxCommandOutput}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if output := strings.TrimSpace(stderr.String()); len(output) > 0 {
+			return nil, fmt.Errorf("synthesizer `%s` failed (%s): %s", s.synth[0], err, output)
+		}
+		return nil, fmt.Errorf("synthesizer `%s` failed: %s", s.synth[0], err)
+	}
+
+	if len(outputFile) > 0 {
+		return audio.LoadWAV(outputFile)
+	}
+	return audio.DecodeWAV(&stdout)
+}
@@ -0,0 +1,99 @@
+package ringer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/luxeria/doorbell/pkg/audio"
+)
+
+type recordingOutput struct {
+	plays []*audio.Buffer
+	mutex sync.Mutex
+}
+
+func (o *recordingOutput) Play(b *audio.Buffer) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.plays = append(o.plays, b)
+	return nil
+}
+
+func TestSpeech(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	voice := &audio.Buffer{SampleRate: 8000, Channels: 1, Samples: []int16{1, 2, 3}}
+	f, err := os.Create(filepath.Join(dir, "voice.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio.EncodeWAV(f, voice)
+	f.Close()
+
+	// records the spoken text and renders the prepared wave file
+	script := `cat >> "$0/spoken.txt"; echo >> "$0/spoken.txt"; cp "$0/voice.wav" "$1"`
+	chime := &recordingOutput{}
+	output := &recordingOutput{}
+	s := NewSpeech(NewAudio(voice, chime, 1), []string{"sh", "-c", script, dir, "{output}"}, output, 1)
+
+	events := []Event{
+		{ID: "1"},
+		{ID: "2", Name: "Anna", Message: "Delivery; $(rm -rf /)"},
+		{ID: "3", Name: "Anna", Message: "Delivery; $(rm -rf /)"},
+	}
+	for _, e := range events {
+		err = s.Ring(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(chime.plays) != 3 {
+		t.Errorf("expected three chimes, got %d", len(chime.plays))
+	}
+
+	if len(output.plays) != 2 || len(output.plays[1].Samples) != 3 {
+		t.Errorf("expected two announcements, got %d", len(output.plays))
+	}
+
+	spoken, err := ioutil.ReadFile(filepath.Join(dir, "spoken.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second announcement is served from the cache
+	if string(spoken) != "Anna is at the door: Delivery; $(rm -rf /)\n" {
+		t.Errorf("unexpected spoken text %q", spoken)
+	}
+}
+
+func TestSpeechFallback(t *testing.T) {
+	chime := &recordingOutput{}
+	output := &recordingOutput{}
+	sound := &audio.Buffer{SampleRate: 8000, Channels: 1, Samples: []int16{1}}
+	s := NewSpeech(NewAudio(sound, chime, 1), []string{"sh", "-c", "echo broken voice >&2; exit 1"}, output, 1)
+
+	err := s.Ring(context.Background(), Event{Message: "hello"})
+	if err != nil {
+		t.Errorf("failed synthesis failed the ring: %s", err)
+	}
+
+	if len(chime.plays) != 1 || len(output.plays) != 0 {
+		t.Errorf("expected only the chime, got %d chimes and %d announcements", len(chime.plays), len(output.plays))
+	}
+
+	_, err = s.synthesize(context.Background(), "hello")
+	if err == nil || !strings.Contains(err.Error(), "broken voice") {
+		t.Errorf("expected synthesizer error, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package ringer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/telegram"
+)
+
+const (
+	telegramPollTimeout    = 30 * time.Second
+	telegramRetryInterval  = 5 * time.Second
+	telegramFollowUpWindow = time.Hour
+)
+
+type telegramAnnouncement struct {
+	time     time.Time
+	messages []telegram.Message
+}
+
+// Telegram sends a message with reply buttons to one or more chats for
+// each ring. Replies are received by long polling for callback queries.
+type Telegram struct {
+	bot           *telegram.Bot
+	chats         []string
+	announcements map[string]*telegramAnnouncement
+	mutex         sync.Mutex
+}
+
+func NewTelegram(bot *telegram.Bot, chats []string) *Telegram {
+	if bot == nil {
+		panic("telegram bot is nil")
+	}
+
+	if len(chats) == 0 {
+		panic("telegram chats are empty")
+	}
+
+	return &Telegram{
+		bot:           bot,
+		chats:         chats,
+		announcements: make(map[string]*telegramAnnouncement),
+	}
+}
+
+func replyKeyboard(ringID string) *telegram.InlineKeyboardMarkup {
+	return &telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+			{Text: "I'm coming", CallbackData: ReplyComing + ":" + ringID},
+			{Text: "Nobody here", CallbackData: ReplyNobody + ":" + ringID},
+		}},
+	}
+}
+
+func (t *Telegram) Ring(ctx context.Context, e Event) error {
+	announcement := &telegramAnnouncement{
+		time: e.Time,
+	}
+
+	var errs []error
+	for _, chat := range t.chats {
+		m, err := t.bot.SendMessage(ctx, telegram.SendMessage{
+			ChatID:      chat,
+			Text:        e.Text(),
+			ReplyMarkup: replyKeyboard(e.ID),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify telegram chat %s: %s", chat, err))
+			continue
+		}
+		announcement.messages = append(announcement.messages, m)
+	}
+
+	t.remember(e.ID, announcement)
+	return joinErrors(errs)
+}
+
+func (t *Telegram) remember(ringID string, a *telegramAnnouncement) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for id, old := range t.announcements {
+		if time.Since(old.time) > telegramFollowUpWindow {
+			delete(t.announcements, id)
+		}
+	}
+	t.announcements[ringID] = a
+}
+
+// Acknowledge replaces the reply buttons of the announcement with the reply
+func (t *Telegram) Acknowledge(ctx context.Context, e Event, a Ack) error {
+	t.mutex.Lock()
+	announcement, ok := t.announcements[e.ID]
+	delete(t.announcements, e.ID)
+	t.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	var errs []error
+	for _, m := range announcement.messages {
+		err := t.bot.EditMessageText(ctx, telegram.EditMessageText{
+			ChatID:    m.Chat.ID,
+			MessageID: m.MessageID,
+			Text:      m.Text + "\n\n" + a.Text(),
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// Listen long polls for presses of the reply buttons
+func (t *Telegram) Listen(ctx context.Context, acknowledge AcknowledgeFunc) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := t.bot.GetCallbackQueries(ctx, offset, telegramPollTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to poll telegram updates: %s", err)
+			}
+
+			select {
+			case <-time.After(telegramRetryInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.CallbackQuery != nil {
+				t.answer(ctx, u.CallbackQuery, acknowledge)
+			}
+		}
+	}
+}
+
+func (t *Telegram) answer(ctx context.Context, q *telegram.CallbackQuery, acknowledge AcknowledgeFunc) {
+	answer := "Thank you!"
+
+	parts := strings.SplitN(q.Data, ":", 2)
+	if len(parts) == 2 && (parts[0] == ReplyComing || parts[0] == ReplyNobody) {
+		err := acknowledge(parts[1], Ack{
+			By:    q.From.FirstName,
+			Reply: parts[0],
+			Time:  time.Now(),
+		})
+		if err != nil {
+			answer = fmt.Sprintf("Sorry, %s", err)
+		}
+	} else {
+		answer = "Sorry, I did not understand that."
+	}
+
+	err := t.bot.AnswerCallbackQuery(ctx, telegram.AnswerCallbackQuery{
+		CallbackQueryID: q.ID,
+		Text:            answer,
+	})
+	if err != nil {
+		log.Printf("failed to answer telegram callback query: %s", err)
+	}
+}
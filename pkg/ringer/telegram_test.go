@@ -0,0 +1,162 @@
+package ringer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luxeria/doorbell/pkg/telegram"
+)
+
+// fakeBotAPI is a stand-in for the Telegram Bot API
+type fakeBotAPI struct {
+	mutex    sync.Mutex
+	sent     []telegram.SendMessage
+	edited   []telegram.EditMessageText
+	answered []telegram.AnswerCallbackQuery
+	updates  []telegram.Update
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/bottoken/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		fmt.Fprint(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var result interface{} = true
+	switch strings.TrimPrefix(r.URL.Path, prefix) {
+	case "sendMessage":
+		var m telegram.SendMessage
+		json.NewDecoder(r.Body).Decode(&m)
+		f.sent = append(f.sent, m)
+		result = telegram.Message{
+			MessageID: int64(len(f.sent)),
+			Chat:      telegram.Chat{ID: 1000},
+			Text:      m.Text,
+		}
+	case "editMessageText":
+		var m telegram.EditMessageText
+		json.NewDecoder(r.Body).Decode(&m)
+		f.edited = append(f.edited, m)
+	case "answerCallbackQuery":
+		var a telegram.AnswerCallbackQuery
+		json.NewDecoder(r.Body).Decode(&a)
+		f.answered = append(f.answered, a)
+	case "getUpdates":
+		var params struct {
+			Offset int64 `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		// don't let the long polling client spin
+		time.Sleep(10 * time.Millisecond)
+
+		updates := []telegram.Update{}
+		for _, u := range f.updates {
+			if u.UpdateID >= params.Offset {
+				updates = append(updates, u)
+			}
+		}
+		result = updates
+	default:
+		fmt.Fprint(w, `{"ok":false,"error_code":404,"description":"Not Found"}`)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *fakeBotAPI) answeredCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.answered)
+}
+
+func TestTelegram(t *testing.T) {
+	api := &fakeBotAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tg := NewTelegram(telegram.New(telegram.Config{
+		Token:  "token",
+		APIURL: server.URL,
+	}), []string{"1000"})
+
+	e := Event{ID: "abc", Time: time.Now()}
+	err := tg.Ring(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.sent) != 1 || api.sent[0].ReplyMarkup == nil {
+		t.Fatalf("expected a message with reply buttons, got %+v", api.sent)
+	}
+
+	buttons := api.sent[0].ReplyMarkup.InlineKeyboard[0]
+	if buttons[0].CallbackData != "coming:abc" || buttons[1].CallbackData != "nobody:abc" {
+		t.Errorf("unexpected reply buttons: %+v", buttons)
+	}
+
+	// someone presses "I'm coming"
+	api.mutex.Lock()
+	api.updates = append(api.updates, telegram.Update{
+		UpdateID: 7,
+		CallbackQuery: &telegram.CallbackQuery{
+			ID:   "query",
+			From: telegram.User{FirstName: "Anna"},
+			Data: buttons[0].CallbackData,
+		},
+	})
+	api.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acks := make(chan Ack, 1)
+	go tg.Listen(ctx, func(ringID string, a Ack) error {
+		if ringID != "abc" {
+			t.Errorf("unexpected ring id %q", ringID)
+		}
+		acks <- a
+		return nil
+	})
+
+	select {
+	case a := <-acks:
+		if a.By != "Anna" || a.Reply != ReplyComing {
+			t.Errorf("unexpected acknowledgement: %+v", a)
+		}
+
+		err = tg.Acknowledge(context.Background(), e, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for acknowledgement")
+	}
+
+	// the callback query is answered after acknowledging
+	for i := 0; i < 100 && api.answeredCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if len(api.answered) != 1 || api.answered[0].CallbackQueryID != "query" {
+		t.Errorf("callback query was not answered: %+v", api.answered)
+	}
+
+	if len(api.edited) != 1 || !strings.HasSuffix(api.edited[0].Text, "Anna is on their way to the door.") {
+		t.Errorf("announcement was not updated: %+v", api.edited)
+	}
+}
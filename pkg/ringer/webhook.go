@@ -0,0 +1,58 @@
+package ringer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"text/template"
+
+	"github.com/luxeria/doorbell/pkg/webhook"
+)
+
+// DefaultWebhookTemplate renders a payload understood by Slack, Mattermost
+// and most of their look-alikes
+const DefaultWebhookTemplate = `{"text": {{ .Text | json }}}`
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseWebhookTemplate parses a template rendering the JSON payload of a
+// webhook from an Event. Values should be escaped using the json function.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookFuncs).Parse(text)
+}
+
+// Webhook posts a templated JSON payload to one or more URLs
+type Webhook struct {
+	webhook  *webhook.Webhook
+	template *template.Template
+}
+
+func NewWebhook(w *webhook.Webhook, t *template.Template) *Webhook {
+	if w == nil {
+		panic("webhook is nil")
+	}
+
+	if t == nil {
+		panic("webhook template is nil")
+	}
+
+	return &Webhook{
+		webhook:  w,
+		template: t,
+	}
+}
+
+func (w *Webhook) Ring(ctx context.Context, e Event) error {
+	var body bytes.Buffer
+	err := w.template.Execute(&body, e)
+	if err != nil {
+		return err
+	}
+
+	return w.webhook.Deliver(ctx, body.Bytes())
+}
@@ -0,0 +1,188 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultAPIURL = "https://api.telegram.org"
+
+type Config struct {
+	Token  string
+	APIURL string
+	Client *http.Client
+}
+
+// Bot is a minimal client for the Telegram Bot API
+type Bot struct {
+	endpoint string
+	client   *http.Client
+}
+
+type User struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username,omitempty"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data"`
+}
+
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type SendMessage struct {
+	ChatID      string                `json:"chat_id"`
+	Text        string                `json:"text"`
+	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type EditMessageText struct {
+	ChatID    int64  `json:"chat_id"`
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+type AnswerCallbackQuery struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+}
+
+type getUpdates struct {
+	Offset         int64    `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+}
+
+func New(c Config) *Bot {
+	if len(c.Token) == 0 {
+		panic("telegram bot token is empty")
+	}
+
+	apiURL := c.APIURL
+	if len(apiURL) == 0 {
+		apiURL = DefaultAPIURL
+	}
+
+	// long polling requests are limited by their context instead
+	client := c.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Bot{
+		endpoint: strings.TrimRight(apiURL, "/") + "/bot" + c.Token + "/",
+		client:   client,
+	}
+}
+
+func (b *Bot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.endpoint+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		// the error contains the url, which contains the bot token
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer resp.Body.Close()
+
+	var r response
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return fmt.Errorf("telegram %s returned invalid response: %s", method, err)
+	}
+
+	if !r.OK {
+		return fmt.Errorf("telegram %s failed (%d): %s", method, r.ErrorCode, r.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(r.Result, result)
+}
+
+func (b *Bot) SendMessage(ctx context.Context, m SendMessage) (Message, error) {
+	var sent Message
+	err := b.call(ctx, "sendMessage", m, &sent)
+	return sent, err
+}
+
+// EditMessageText replaces the text of a message, removing its inline keyboard
+func (b *Bot) EditMessageText(ctx context.Context, m EditMessageText) error {
+	return b.call(ctx, "editMessageText", m, nil)
+}
+
+func (b *Bot) AnswerCallbackQuery(ctx context.Context, a AnswerCallbackQuery) error {
+	return b.call(ctx, "answerCallbackQuery", a, nil)
+}
+
+// GetCallbackQueries long polls for callback queries with updates starting
+// at offset, waiting up to timeout for new updates
+func (b *Bot) GetCallbackQueries(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	if timeout < time.Second {
+		return nil, errors.New("long polling timeout must be at least a second")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+10*time.Second)
+	defer cancel()
+
+	var updates []Update
+	err := b.call(ctx, "getUpdates", getUpdates{
+		Offset:         offset,
+		Timeout:        int(timeout / time.Second),
+		AllowedUpdates: []string{"callback_query"},
+	}, &updates)
+	return updates, err
+}
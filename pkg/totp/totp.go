@@ -0,0 +1,117 @@
+// Package totp implements time-based one-time passwords (RFC 6238), as
+// generated by common authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Secret is the shared secret, usually exchanged in base32
+	Secret []byte
+	// Period is how long a code is valid. Codes rotate at multiples of the
+	// period since the Unix epoch, i.e. daily codes rotate at midnight UTC.
+	Period time.Duration
+	// Digits is the length of the codes
+	Digits int
+	// Skew is the number of preceding and following codes also accepted
+	Skew int
+}
+
+type Totp struct {
+	secret []byte
+	period time.Duration
+	digits int
+	skew   int
+}
+
+func New(c Config) *Totp {
+	if len(c.Secret) == 0 {
+		panic("totp secret must not be empty")
+	}
+
+	if c.Period < time.Second {
+		panic("totp period must be at least one second")
+	}
+
+	if c.Digits < 4 || c.Digits > 10 {
+		panic("totp digits must be between 4 and 10")
+	}
+
+	if c.Skew < 0 {
+		panic("totp skew must not be negative")
+	}
+
+	return &Totp{
+		secret: c.Secret,
+		period: c.Period,
+		digits: c.Digits,
+		skew:   c.Skew,
+	}
+}
+
+// DecodeSecret decodes a base32 secret, ignoring case, spaces and padding
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.Replace(s, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+}
+
+func (t *Totp) counter(now time.Time) int64 {
+	return now.Unix() / int64(t.period/time.Second)
+}
+
+// hotp computes the HMAC-based one-time password (RFC 4226) of a counter
+func (t *Totp) hotp(counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, t.secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+
+	modulo := uint64(1)
+	for i := 0; i < t.digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.digits, value%modulo)
+}
+
+// Code returns the code valid at the given time
+func (t *Totp) Code(now time.Time) string {
+	return t.hotp(t.counter(now))
+}
+
+// Expires returns when the code valid at the given time rotates
+func (t *Totp) Expires(now time.Time) time.Time {
+	seconds := int64(t.period / time.Second)
+	return time.Unix((t.counter(now)+1)*seconds, 0)
+}
+
+// Validate reports whether a code is valid at the given time, within the
+// configured skew
+func (t *Totp) Validate(code string, now time.Time) bool {
+	if len(code) != t.digits {
+		return false
+	}
+
+	valid := false
+	counter := t.counter(now)
+	for i := counter - int64(t.skew); i <= counter+int64(t.skew); i++ {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(t.hotp(i))) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// test vectors of RFC 6238, appendix B (SHA-1)
+	totp := New(Config{
+		Secret: []byte("12345678901234567890"),
+		Period: 30 * time.Second,
+		Digits: 8,
+	})
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		if code := totp.Code(now); code != tt.code {
+			t.Errorf("%d: expected %s, got %s", tt.unix, tt.code, code)
+		}
+
+		if !totp.Validate(tt.code, now) {
+			t.Errorf("%d: code %s was not accepted", tt.unix, tt.code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret, err := DecodeSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totp := New(Config{Secret: secret, Period: 24 * time.Hour, Digits: 6, Skew: 1})
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if expires := totp.Expires(now); !expires.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry %s", expires)
+	}
+
+	yesterday := totp.Code(now.Add(-24 * time.Hour))
+	if !totp.Validate(yesterday, now) {
+		t.Error("code of the previous period was not accepted")
+	}
+
+	if totp.Validate(totp.Code(now.Add(-48*time.Hour)), now) {
+		t.Error("code of two periods ago was accepted")
+	}
+
+	if totp.Validate("12345", now) {
+		t.Error("code of wrong length was accepted")
+	}
+}
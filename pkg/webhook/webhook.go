@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const SignatureHeader = "X-Doorbell-Signature"
+
+type Config struct {
+	Targets []string
+	// Secret is used to sign the request body with HMAC-SHA256, if set
+	Secret []byte
+	// Timeout limits each delivery attempt to a single target
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+	// DeadLetter is the path of a file to which undeliverable requests are
+	// appended as JSON lines. Undeliverable requests are only logged if empty.
+	DeadLetter string
+	Client     *http.Client
+}
+
+type Webhook struct {
+	targets    []string
+	secret     []byte
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	deadLetter string
+	client     *http.Client
+	mutex      sync.Mutex
+}
+
+func New(c Config) *Webhook {
+	if len(c.Targets) == 0 {
+		panic("webhook targets are empty")
+	}
+
+	if c.Timeout <= 0 {
+		panic("webhook timeout must be positive")
+	}
+
+	if c.Retries < 0 {
+		panic("webhook retries must not be negative")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Webhook{
+		targets:    c.Targets,
+		secret:     c.Secret,
+		timeout:    c.Timeout,
+		retries:    c.Retries,
+		backoff:    c.Backoff,
+		deadLetter: c.DeadLetter,
+		client:     client,
+	}
+}
+
+func Sign(body []byte, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// permanentError marks failures which are not worth retrying
+type permanentError struct {
+	error
+}
+
+// Deliver posts the JSON body to all targets concurrently
+func (w *Webhook) Deliver(ctx context.Context, body []byte) error {
+	if !json.Valid(body) {
+		return errors.New("webhook body is not valid json")
+	}
+
+	errs := make([]error, len(w.targets))
+
+	var wg sync.WaitGroup
+	for i, target := range w.targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			errs[i] = w.deliver(ctx, target, body)
+		}(i, target)
+	}
+	wg.Wait()
+
+	failed := 0
+	var last error
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			last = err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("webhook delivery to %d of %d targets failed, last error: %s", failed, len(w.targets), last)
+	}
+
+	return nil
+}
+
+func (w *Webhook) deliver(ctx context.Context, target string, body []byte) error {
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err := w.post(ctx, target, body)
+		if err == nil {
+			return nil
+		}
+
+		_, permanent := err.(permanentError)
+		if permanent || attempt > w.retries {
+			w.bury(target, body, attempt, err)
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			w.bury(target, body, attempt, err)
+			return err
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, target string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(body, w.secret))
+	}
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook %s returned %s", target, resp.Status)
+	default:
+		return permanentError{fmt.Errorf("webhook %s returned %s", target, resp.Status)}
+	}
+}
+
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	Target   string          `json:"target"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// bury records an undeliverable request in the dead letter log
+func (w *Webhook) bury(target string, body []byte, attempts int, err error) {
+	log.Printf("webhook %s failed after %d attempts: %s", target, attempts, err)
+	if len(w.deadLetter) == 0 {
+		return
+	}
+
+	line, err := json.Marshal(deadLetter{
+		Time:     time.Now(),
+		Target:   target,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Body:     body,
+	})
+	if err == nil {
+		err = w.appendDeadLetter(append(line, '\n'))
+	}
+
+	if err != nil {
+		log.Printf("failed to write webhook dead letter log: %s", err)
+	}
+}
+
+func (w *Webhook) appendDeadLetter(line []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	f, err := os.OpenFile(w.deadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(line)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliverSigned(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"text":"ring"}`)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign(received, secret) {
+			t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+		}
+
+		// fail the first attempt
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	w := New(Config{
+		Targets: []string{server.URL},
+		Secret:  secret,
+		Timeout: time.Second,
+		Retries: 2,
+		Backoff: time.Millisecond,
+	})
+
+	err := w.Deliver(context.Background(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	deadLetterLog := filepath.Join(dir, "dead.jsonl")
+	w := New(Config{
+		Targets:    []string{server.URL},
+		Timeout:    time.Second,
+		Retries:    3,
+		Backoff:    time.Millisecond,
+		DeadLetter: deadLetterLog,
+	})
+
+	err = w.Deliver(context.Background(), []byte(`{"text":"ring"}`))
+	if err == nil {
+		t.Fatal("expected delivery to fail")
+	}
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("client errors should not be retried, got %d attempts", calls)
+	}
+
+	data, err := ioutil.ReadFile(deadLetterLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry deadLetter
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Target != server.URL || entry.Attempts != 1 || string(entry.Body) != `{"text":"ring"}` {
+		t.Errorf("unexpected dead letter entry: %s", data)
+	}
+}
+
+func TestDeliverInvalidBody(t *testing.T) {
+	w := New(Config{Targets: []string{"http://localhost"}, Timeout: time.Second})
+
+	err := w.Deliver(context.Background(), []byte(`{"text":`))
+	if err == nil {
+		t.Error("invalid json body was not rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if string(data) == "bye" {
+				conn.Close(CloseGoingAway, "see you")
+				return
+			}
+
+			err = conn.WriteMessage(op, data)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+}
+
+func dial(t *testing.T, s *httptest.Server) *Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, "ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestEcho(t *testing.T) {
+	s := echoServer(t)
+	defer s.Close()
+
+	conn := dial(t, s)
+	defer conn.Close(CloseNormal, "")
+	conn.SetReadTimeout(5 * time.Second)
+
+	messages := [][]byte{
+		[]byte("hello"),
+		bytes.Repeat([]byte("a"), 1000),  // 16 bit length
+		bytes.Repeat([]byte("b"), 70000), // 64 bit length, exceeds default limit
+	}
+
+	for i, m := range messages[:2] {
+		err := conn.WriteMessage(OpText, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the server answers pings while waiting for the next message
+		err = conn.Ping()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if op != OpText || !bytes.Equal(data, m) {
+			t.Errorf("message %d: unexpected echo (opcode %d, %d bytes)", i, op, len(data))
+		}
+	}
+
+	err := conn.WriteMessage(OpBinary, messages[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = conn.ReadMessage()
+	if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != CloseTooBig {
+		t.Errorf("expected connection to be closed as too big, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := echoServer(t)
+	defer s.Close()
+
+	conn := dial(t, s)
+	conn.SetReadTimeout(5 * time.Second)
+
+	err := conn.WriteMessage(OpText, []byte("bye"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*CloseError)
+	if !ok {
+		t.Fatalf("expected close error, got %v", err)
+	}
+
+	if closeErr.Code != CloseGoingAway || closeErr.Reason != "see you" {
+		t.Errorf("unexpected close error: %s", closeErr)
+	}
+
+	if conn.WriteMessage(OpText, []byte("hello?")) != ErrClosed {
+		t.Error("writing to closed connection did not fail")
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	s := echoServer(t)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status %s", resp.Status)
+	}
+}
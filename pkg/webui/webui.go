@@ -1,14 +1,17 @@
 package webui
 
 import (
+	"context"
 	"html/template"
 	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
 type WebUI struct {
+	dir     string
 	static  http.Handler
 	dynamic *template.Template
 	context Context
@@ -31,6 +34,7 @@ func New(dir string, context Context) (*WebUI, error) {
 	}
 
 	webUI := &WebUI{
+		dir:     dir,
 		static:  http.FileServer(http.Dir(dir)),
 		dynamic: dynamic,
 		context: context,
@@ -39,6 +43,18 @@ func New(dir string, context Context) (*WebUI, error) {
 	return webUI, nil
 }
 
+// Check verifies that the static files are still accessible
+func (ui *WebUI) Check(ctx context.Context) error {
+	f, err := os.Open(ui.dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	return err
+}
+
 func canonicalizePath(path string) string {
 	if len(path) == 0 || strings.HasSuffix(path, "/") {
 		path += "index.html"